@@ -1,21 +1,25 @@
 package file_manager
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"os"
 	"strings"
-	"time"
 
 	"go.uber.org/zap"
-)
 
-var (
-	entriesCheckedCount int
-	movedFileCount      int
-	FilesToMoveCount    int
+	"github.com/photos-sorter/pkg/progress"
+	"github.com/photos-sorter/pkg/walk"
 )
 
+// Progress being how many files have been through each stage of the sort, files copied and moved are
+// counted here and the other stages by the sort
+var Progress = &progress.Tracker{}
+
 func GetFilesSingleFolder[T any](logger *zap.Logger, path string, fileTypes []string,
 	includeFiles bool, fileData func(string) (T, error)) (map[string]T, error,
 ) {
@@ -29,8 +33,6 @@ func GetFilesSingleFolder[T any](logger *zap.Logger, path string, fileTypes []st
 		zap.Any("entries", entries))
 	files := make(map[string]T)
 	for _, e := range entries {
-		entriesCheckedCount++
-		logger.Info(fmt.Sprintf("%d entries checked", entriesCheckedCount))
 		if e.IsDir() || !isUsableFileType(fileTypes, e.Name(), includeFiles) {
 			logger.Debug("skipping file",
 				zap.String("name", e.Name()),
@@ -55,65 +57,57 @@ func GetFilesSingleFolder[T any](logger *zap.Logger, path string, fileTypes []st
 	return files, nil
 }
 
-func GetFilesAllDepths[T any](logger *zap.Logger, path string, fileTypes []string,
-	includeFiles bool, fileData func(*zap.Logger, string) (T, error)) (map[string]T, error,
-) {
-	entries, err := getDirectoryEntries(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get directory entries: %w", err)
-	}
-	logger.Debug("got directory entries", zap.String("path", path), zap.Any("entries", entries))
-
-	var directoryTotal, fileTotal int
-	files := make(map[string]T)
-	for _, e := range entries {
-		entriesCheckedCount++
-		logger.Info(fmt.Sprintf("%d entries checked", entriesCheckedCount))
-
-		if e.IsDir() {
-			logger.Debug("getting files from subfolder", zap.String("name", e.Name()))
-			subFiles, err := GetFilesAllDepths(logger, path+"/"+e.Name(), fileTypes, includeFiles, fileData)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get files from subfolder: %w", err)
+// WalkFiles streams the paths of the files of the file types from the folder and its subfolders as they are
+// found, walked by the walk options. skip is optional and leaves out folders and files such as those filtered
+// out by the config. A walk that fails ends with its error.
+func WalkFiles(logger *zap.Logger, path string, fileTypes []string, includeFiles bool,
+	opts walk.Options, skip func(string, os.DirEntry) bool,
+) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		stopped := false
+		err := walkFiles(logger, path, opts, skip, func(filePath string, e os.DirEntry) bool {
+			if !isUsableFileType(fileTypes, e.Name(), includeFiles) {
+				return true
 			}
-
-			files = mergeMaps(files, subFiles)
-			directoryTotal++
-		} else if isUsableFileType(fileTypes, e.Name(), includeFiles) {
-			logger.Debug("getting file data", zap.String("name", e.Name()))
-			file, err := fileData(logger, path+"/"+e.Name())
-			if err != nil {
-				logger.Error("failed to get file data",
-					zap.String("name", e.Name()))
-				continue
+			if skip != nil && skip(filePath, e) {
+				return true
 			}
-			logger.Debug("got file data", zap.String("name", e.Name()), zap.Any("file", file))
-
-			files[e.Name()] = file
-			fileTotal++
+			stopped = !yield(filePath, nil)
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield("", fmt.Errorf("failed to walk folder: %w", err))
 		}
 	}
-
-	logger.Debug("got files from folder",
-		zap.String("path", path),
-		zap.Int("directoryTotal", directoryTotal),
-		zap.Int("fileTotal", fileTotal),
-		zap.Int("totalEntries", directoryTotal+fileTotal))
-	return files, nil
 }
 
-func SortFilesByDate[T any](files map[string]T, getTimeStamp func(T) time.Time) map[string][]T {
-	sortedFiles := make(map[string][]T)
-	for _, f := range files {
-		timestamp := getTimeStamp(f)
-		folderName := formatFolderName(timestamp.Year(), int(timestamp.Month()), timestamp.Day())
-		if _, ok := sortedFiles[folderName]; !ok {
-			sortedFiles[folderName] = make([]T, 0)
+// GetFilesAllDepths gets the files of the file types from the folder and its subfolders, keyed by path,
+// see WalkFiles
+func GetFilesAllDepths[T any](logger *zap.Logger, path string, fileTypes []string, includeFiles bool,
+	opts walk.Options, skip func(string, os.DirEntry) bool, fileData func(*zap.Logger, string) (T, error),
+) (map[string]T, error) {
+	files := make(map[string]T)
+	for filePath, err := range WalkFiles(logger, path, fileTypes, includeFiles, opts, skip) {
+		if err != nil {
+			return nil, err
 		}
-		sortedFiles[folderName] = append(sortedFiles[folderName], f)
+		logger.Debug("getting file data", zap.String("path", filePath))
+		file, err := fileData(logger, filePath)
+		if err != nil {
+			logger.Error("failed to get file data",
+				zap.String("path", filePath))
+			continue
+		}
+		logger.Debug("got file data", zap.String("path", filePath), zap.Any("file", file))
+
+		// keyed by path as names repeat across folders, such as avchd clips numbered from 00000 on every card
+		files[filePath] = file
 	}
 
-	return sortedFiles
+	logger.Debug("got files from all depths",
+		zap.String("path", path),
+		zap.Int("fileTotal", len(files)))
+	return files, nil
 }
 
 func AddFolderPathToFile[T any](logger *zap.Logger, files map[string]T, addFolderPath func(*zap.Logger, T) T) map[string]T {
@@ -158,69 +152,127 @@ func CreatePathFoldersIfDoesntExists(logger *zap.Logger, foldersPath, path strin
 }
 
 func MoveAndRenameFile(logger *zap.Logger, src, dst string) error {
-	if _, err := os.Stat(dst); err == nil {
-		logger.Debug("Destination file already exists", zap.String("destination", dst))
+	exists, err := destinationExists(logger, src, dst)
+	if err != nil {
+		Progress.CopyFailed()
+		return err
+	}
+	if exists {
+		Progress.Existing()
 		return nil
-	} else if !os.IsNotExist(err) {
-		return fmt.Errorf("failed to check destination file: %w", err)
 	}
 
-	err := os.Rename(src, dst)
+	var size int64
+	if info, err := os.Stat(src); err == nil {
+		size = info.Size()
+	}
+	err = os.Rename(src, dst)
 	if err != nil {
+		Progress.CopyFailed()
 		return fmt.Errorf("failed to rename file: %w", err)
 	}
-	movedFileCount++
-	logger.Info(fmt.Sprintf("[ %d / %d ] files moved", movedFileCount, FilesToMoveCount))
+	Progress.Copied(size)
+	logger.Debug("moved file", zap.String("source", src), zap.String("destination", dst))
 	return nil
 }
 
 func CopyAndRenameFile(logger *zap.Logger, src, dst string) error {
-	err := copyFile(logger, src, dst)
+	exists, err := destinationExists(logger, src, dst)
+	if err != nil {
+		Progress.CopyFailed()
+		return err
+	}
+	if exists {
+		Progress.Existing()
+		return nil
+	}
+
+	size, err := copyFile(src, dst)
 	if err != nil {
+		Progress.CopyFailed()
 		return fmt.Errorf("failed to copy file: %w", err)
 	}
-	movedFileCount++
-	logger.Info(fmt.Sprintf("[ %d / %d ] files copied", movedFileCount, FilesToMoveCount))
+	Progress.Copied(size)
+	logger.Debug("copied file", zap.String("source", src), zap.String("destination", dst))
 	return nil
 }
 
-func copyFile(logger *zap.Logger, src, dst string) error {
-	if _, err := os.Stat(dst); err == nil {
-		logger.Debug("Destination file already exists", zap.String("destination", dst))
-		return nil
-	} else if !os.IsNotExist(err) {
-		return fmt.Errorf("failed to check destination file: %w", err)
+// ErrDestinationTaken being when a different file is already at the destination, such as two files given the
+// same name by the name template
+var ErrDestinationTaken = errors.New("destination is already a different file")
+
+// destinationExists checks whether the file is already at the destination, from an earlier run, which is
+// left as it is. A different file there is an ErrDestinationTaken, it is the same file when the size and
+// contents match.
+func destinationExists(logger *zap.Logger, src, dst string) (bool, error) {
+	dstInfo, err := os.Stat(dst)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to check destination file: %w", err)
 	}
 
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false, fmt.Errorf("failed to check source file: %w", err)
+	}
+	if srcInfo.Size() != dstInfo.Size() {
+		return false, fmt.Errorf("%w: %s", ErrDestinationTaken, dst)
+	}
+	srcHash, err := ShortHash(src)
+	if err != nil {
+		return false, err
+	}
+	dstHash, err := ShortHash(dst)
+	if err != nil {
+		return false, err
+	}
+	if srcHash != dstHash {
+		return false, fmt.Errorf("%w: %s", ErrDestinationTaken, dst)
+	}
+
+	logger.Debug("Destination file already exists", zap.String("destination", dst))
+	return true, nil
+}
+
+func copyFile(src, dst string) (int64, error) {
 	srcFile, err := os.Open(src)
 	if err != nil {
-		return fmt.Errorf("failed to open source file: %w", err)
+		return 0, fmt.Errorf("failed to open source file: %w", err)
 	}
 	defer srcFile.Close()
 
 	dstFile, err := os.Create(dst)
 	if err != nil {
-		return fmt.Errorf("failed to create destination file: %w", err)
+		return 0, fmt.Errorf("failed to create destination file: %w", err)
 	}
 	defer dstFile.Close()
 
-	_, err = io.Copy(dstFile, srcFile)
+	size, err := io.Copy(dstFile, srcFile)
 	if err != nil {
-		return fmt.Errorf("failed to copy file: %w", err)
+		return 0, fmt.Errorf("failed to copy file: %w", err)
 	}
 
 	err = dstFile.Sync()
 	if err != nil {
-		return fmt.Errorf("failed to sync destination file: %w", err)
+		return 0, fmt.Errorf("failed to sync destination file: %w", err)
 	}
 
-	return nil
+	return size, nil
 }
 
-func ReturnFilesCount() int {
-	return movedFileCount
-}
+// ShortHash returns the first 8 characters of the sha256 of the file's contents
+func ShortHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
 
-func ReturnEntriesCheckedCount() int {
-	return entriesCheckedCount
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:8], nil
 }
@@ -0,0 +1,160 @@
+package file_manager
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/photos-sorter/pkg/walk"
+)
+
+// walker walks a folder and its subfolders with filepath.WalkDir, which doesn't follow symlinks, so symlinked
+// folders are walked by their real path and the paths under them given as under the symlink
+type walker struct {
+	logger *zap.Logger
+	opts   walk.Options
+	skip   func(string, os.DirEntry) bool
+	visit  func(string, os.DirEntry) bool
+
+	// walked being the real paths of the folders walked, so a folder symlinked to is only walked once
+	walked map[string]bool
+	// stopped being when visit has returned false, so the walks of any symlinked folders stop too
+	stopped bool
+}
+
+// walkFiles calls visit with the path of every file in the folder and its subfolders until it returns false,
+// skip is optional and leaves out folders
+func walkFiles(logger *zap.Logger, root string, opts walk.Options, skip func(string, os.DirEntry) bool,
+	visit func(string, os.DirEntry) bool,
+) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	w := &walker{logger: logger, opts: opts, skip: skip, visit: visit, walked: make(map[string]bool)}
+	return w.walk(realRoot, filepath.Clean(root), 0, true)
+}
+
+// walk walks the real path as though it were at the path given, at the depth of its folder
+func (w *walker) walk(realPath, path string, depth int, isRoot bool) error {
+	return filepath.WalkDir(realPath, func(p string, e fs.DirEntry, err error) error {
+		if w.stopped {
+			return filepath.SkipAll
+		}
+		rel, relErr := filepath.Rel(realPath, p)
+		if relErr != nil {
+			return fmt.Errorf("failed to get path under %s: %w", realPath, relErr)
+		}
+		shown := filepath.Join(path, rel)
+
+		if err != nil {
+			if isRoot && p == realPath {
+				return fmt.Errorf("failed to read directory: %w", err)
+			}
+			if w.opts.StopOnError {
+				return fmt.Errorf("failed to read directory %s: %w", shown, err)
+			}
+			w.logger.Warn("skipping folder that can't be read", zap.String("path", shown), zap.Error(err))
+			if e != nil && e.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if p == realPath {
+			w.walked[p] = true
+			return nil
+		}
+		entryDepth := depth + strings.Count(rel, string(filepath.Separator)) + 1
+		if e.Type()&fs.ModeSymlink != 0 {
+			return w.symlink(p, shown, e, entryDepth)
+		}
+		if e.IsDir() {
+			if !w.enterDir(shown, e, entryDepth) || w.walked[p] {
+				return filepath.SkipDir
+			}
+			w.walked[p] = true
+			return nil
+		}
+		if w.opts.SkipFile(e.Name()) {
+			w.logger.Debug("skipping hidden file", zap.String("path", shown))
+			return nil
+		}
+		return w.visitFile(shown, e)
+	})
+}
+
+func (w *walker) visitFile(path string, e os.DirEntry) error {
+	if !w.visit(path, e) {
+		w.stopped = true
+		return filepath.SkipAll
+	}
+	return nil
+}
+
+// enterDir checks whether a folder is walked, by the walk options and then the skip hook
+func (w *walker) enterDir(path string, e os.DirEntry, depth int) bool {
+	if reason, skipped := w.opts.SkipDir(e.Name(), depth); skipped {
+		w.logger.Debug("skipping folder", zap.String("path", path), zap.String("reason", reason))
+		return false
+	}
+	return w.skip == nil || !w.skip(path, e)
+}
+
+// symlink walks the folder or visits the file the symlink points to when following symlinks
+func (w *walker) symlink(realPath, path string, e os.DirEntry, depth int) error {
+	if !w.opts.FollowSymlinks {
+		w.logger.Debug("skipping symlink", zap.String("path", path))
+		return nil
+	}
+
+	target, err := filepath.EvalSymlinks(realPath)
+	if err != nil {
+		w.logger.Warn("skipping broken symlink", zap.String("path", path), zap.Error(err))
+		return nil
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		w.logger.Warn("skipping broken symlink", zap.String("path", path), zap.Error(err))
+		return nil
+	}
+
+	// the entry keeps the symlink's name, so the file keeps it too
+	entry := fs.FileInfoToDirEntry(linkedInfo{FileInfo: info, name: e.Name()})
+	if !info.IsDir() {
+		if w.opts.SkipFile(e.Name()) {
+			return nil
+		}
+		return w.visitFile(path, entry)
+	}
+
+	if w.walked[target] {
+		if strings.HasPrefix(filepath.Dir(realPath)+string(filepath.Separator), target+string(filepath.Separator)) {
+			w.logger.Warn("skipping symlink that loops back to a parent folder",
+				zap.String("path", path), zap.String("target", target))
+		} else {
+			w.logger.Debug("skipping symlink to a folder that was already walked",
+				zap.String("path", path), zap.String("target", target))
+		}
+		return nil
+	}
+	if !w.enterDir(path, entry, depth) {
+		return nil
+	}
+
+	return w.walk(target, path, depth, false)
+}
+
+// linkedInfo being the info of the file a symlink points to under the symlink's name
+type linkedInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i linkedInfo) Name() string {
+	return i.name
+}
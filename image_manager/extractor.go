@@ -0,0 +1,76 @@
+package image_manager
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/evanoberholster/imagemeta/meta"
+	"go.uber.org/zap"
+
+	"github.com/photos-sorter/pkg/metadata"
+)
+
+// ImagemetaExtractor reads image metadata natively, using imagemeta for exif along with
+// the png, webp and raw decoders
+type ImagemetaExtractor struct{}
+
+func (ImagemetaExtractor) Name() string {
+	return metadata.ExtractorImagemeta
+}
+
+func (ImagemetaExtractor) Supports(ext string) bool {
+	_, ok := imageDecoders[ext]
+	return ok
+}
+
+func (ImagemetaExtractor) Close() {}
+
+func (ImagemetaExtractor) Extract(_ *zap.Logger, path string) (metadata.Record, error) {
+	decode, ok := imageDecoders[metadata.Ext(path)]
+	if !ok {
+		decode = decodeExif
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return metadata.Record{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	d, err := decode(f)
+	if err != nil {
+		return metadata.Record{}, err
+	}
+	return toRecord(d), nil
+}
+
+func toRecord(d decodedImage) metadata.Record {
+	r := metadata.Record{
+		Make:            d.exif.Make,
+		Model:           d.exif.Model,
+		CameraSerial:    d.exif.CameraSerial,
+		Lens:            d.exif.LensModel,
+		Software:        d.exif.Software,
+		Width:           d.width,
+		Height:          d.height,
+		Orientation:     int(d.exif.Orientation),
+		Timestamp:       d.timestamp,
+		TimestampSource: d.timestampSource,
+		ExposureBias:    exposureBiasEV(d.exif.ExposureBias),
+		AutoBracket:     d.exif.ExposureMode == meta.ExposureModeAutoBracket,
+	}
+	if lat, lon := d.exif.GPS.Latitude(), d.exif.GPS.Longitude(); lat != 0 || lon != 0 {
+		r.Location = &metadata.Location{Latitude: lat, Longitude: lon}
+	}
+	return r
+}
+
+// exposureBiasEV converts the exposure bias from its "+1/3" fraction form
+func exposureBiasEV(bias meta.ExposureBias) float64 {
+	var n, d int
+	_, err := fmt.Sscanf(bias.String(), "%d/%d", &n, &d)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
@@ -0,0 +1,378 @@
+package image_manager
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/gif"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/evanoberholster/imagemeta"
+	"github.com/evanoberholster/imagemeta/exif2"
+)
+
+const (
+	// maxMetadataChunk being the largest exif, xmp or text chunk that is read, and the most text is inflated to
+	maxMetadataChunk = 4 << 20
+	// webpHeaderSize being how much of the VP8X, VP8 and VP8L chunks is needed for the dimensions
+	webpHeaderSize = 10
+)
+
+var (
+	ErrNotPng  = errors.New("not a png file")
+	ErrNotWebp = errors.New("not a webp file")
+
+	// imageDecoders keyed by lower case file extension, raw formats are added from their registry
+	imageDecoders = map[string]func(io.ReadSeeker) (decodedImage, error){
+		"jpg":  decodeExif,
+		"jpeg": decodeExif,
+		"tif":  decodeExif,
+		"tiff": decodeExif,
+		"heic": decodeHeif,
+		"heif": decodeHeif,
+		"png":  decodePng,
+		"webp": decodeWebp,
+		"gif":  decodeGif,
+	}
+
+	// textTimeLayouts are the layouts dates are commonly written in within png text chunks and xmp
+	textTimeLayouts = []string{
+		time.RFC3339Nano,
+		time.RFC1123Z,
+		time.RFC1123,
+		time.ANSIC,
+		"2006:01:02 15:04:05",
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04",
+	}
+
+	xmpDateRegex = regexp.MustCompile(
+		`(?:exif:DateTimeOriginal|photoshop:DateCreated|xmp:CreateDate)(?:="|>)([^"<]+)`)
+)
+
+// decodedImage being the metadata found in an image, where formats without exif
+// may still have a timestamp and dimensions from elsewhere in the file
+type decodedImage struct {
+	exif            exif2.Exif
+	timestamp       time.Time
+	timestampSource string
+	width           int
+	height          int
+}
+
+func decodeExif(r io.ReadSeeker) (decodedImage, error) {
+	e, err := imagemeta.Decode(r)
+	if err != nil {
+		return decodedImage{}, err
+	}
+	return decodedFromExif(e), nil
+}
+
+// decodeHeif reads the exif from the heif item boxes, imagemeta's generic Decode treats heif as
+// tiff so this uses the same isobmff reader as cr3 and avif
+func decodeHeif(r io.ReadSeeker) (decodedImage, error) {
+	e, err := imagemeta.DecodeCR3(r)
+	if err != nil {
+		return decodedImage{}, err
+	}
+	return decodedFromExif(e), nil
+}
+
+func decodedFromExif(e exif2.Exif) decodedImage {
+	d := decodedImage{
+		exif:            e,
+		timestamp:       e.DateTimeOriginal(),
+		timestampSource: "exif DateTimeOriginal",
+		width:           int(e.ImageWidth),
+		height:          int(e.ImageHeight),
+	}
+	if d.timestamp.IsZero() {
+		d.timestamp = e.CreateDate()
+		d.timestampSource = "exif CreateDate"
+	}
+	if d.timestamp.IsZero() {
+		d.timestampSource = "none"
+	}
+	return d
+}
+
+// decodePng reads the eXIf chunk if there is one, otherwise the creation time from the tEXt,
+// iTXt and zTXt chunks, screenshots often have neither so no metadata is not an error
+func decodePng(r io.ReadSeeker) (decodedImage, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	var d decodedImage
+
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != signature {
+		return d, ErrNotPng
+	}
+
+	for {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			break
+		}
+		length := binary.BigEndian.Uint32(buf[0:4])
+		chunkType := string(buf[4:8])
+
+		switch chunkType {
+		case "IHDR", "eXIf", "tEXt", "iTXt", "zTXt":
+			// chunks are followed by their crc, longer chunks than any metadata are corrupt and skipped
+			n := int64(length)
+			if n > maxMetadataChunk {
+				n = 0
+			}
+			data, err := readChunk(r, int64(length), n, 4)
+			if err != nil {
+				return d, fmt.Errorf("failed to read png %s chunk: %w", chunkType, err)
+			}
+			if len(data) > 0 {
+				d = addPngChunk(d, chunkType, data)
+			}
+		case "IEND":
+			return d, nil
+		default:
+			if _, err := r.Seek(int64(length)+4, io.SeekCurrent); err != nil {
+				return d, fmt.Errorf("failed to seek png chunk: %w", err)
+			}
+		}
+	}
+	return d, nil
+}
+
+func addPngChunk(d decodedImage, chunkType string, data []byte) decodedImage {
+	switch chunkType {
+	case "IHDR":
+		if len(data) >= 8 {
+			d.width = int(binary.BigEndian.Uint32(data[0:4]))
+			d.height = int(binary.BigEndian.Uint32(data[4:8]))
+		}
+	case "eXIf":
+		return withExifPayload(d, data)
+	case "tEXt", "iTXt", "zTXt":
+		keyword, text, ok := pngText(chunkType, data)
+		if !ok {
+			return d
+		}
+		switch strings.ToLower(keyword) {
+		case "raw profile type exif", "raw profile type app1":
+			return withExifPayload(d, rawProfileBytes(text))
+		case "xml:com.adobe.xmp":
+			return withTextTimestamp(d, xmpDate(text), "png xmp")
+		case "creation time", "date:create":
+			return withTextTimestamp(d, text, "png "+keyword)
+		}
+	}
+	return d
+}
+
+// pngText returns the keyword and text of a png text chunk, decompressing it if needed
+func pngText(chunkType string, data []byte) (string, string, bool) {
+	keyword, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return "", "", false
+	}
+
+	switch chunkType {
+	case "tEXt":
+		return string(keyword), string(rest), true
+	case "zTXt":
+		if len(rest) < 1 {
+			return "", "", false
+		}
+		text, err := inflate(rest[1:])
+		return string(keyword), string(text), err == nil
+	case "iTXt":
+		// compression flag, compression method, language tag, translated keyword, text
+		if len(rest) < 2 {
+			return "", "", false
+		}
+		compressed := rest[0] == 1
+		_, rest, ok = bytes.Cut(rest[2:], []byte{0})
+		if !ok {
+			return "", "", false
+		}
+		_, text, ok := bytes.Cut(rest, []byte{0})
+		if !ok {
+			return "", "", false
+		}
+		if compressed {
+			var err error
+			text, err = inflate(text)
+			if err != nil {
+				return "", "", false
+			}
+		}
+		return string(keyword), string(text), true
+	}
+	return "", "", false
+}
+
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(io.LimitReader(zr, maxMetadataChunk))
+}
+
+// rawProfileBytes decodes an ImageMagick raw profile, being a name line, a length line then hex
+func rawProfileBytes(text string) []byte {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) < 3 {
+		return nil
+	}
+	data, err := hex.DecodeString(strings.Join(strings.Fields(strings.Join(lines[2:], "")), ""))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// decodeGif reads only the dimensions, gifs have no camera metadata or capture time
+func decodeGif(r io.ReadSeeker) (decodedImage, error) {
+	cfg, err := gif.DecodeConfig(r)
+	if err != nil {
+		return decodedImage{}, fmt.Errorf("failed to decode gif: %w", err)
+	}
+	return decodedImage{width: cfg.Width, height: cfg.Height}, nil
+}
+
+// decodeWebp reads the dimensions and the EXIF and XMP chunks from a webp's riff container
+func decodeWebp(r io.ReadSeeker) (decodedImage, error) {
+	var d decodedImage
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[0:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return d, ErrNotWebp
+	}
+
+	buf := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			break
+		}
+		chunkType := string(buf[0:4])
+		length := binary.LittleEndian.Uint32(buf[4:8])
+		// chunks are padded to an even length
+		padded := int64(length) + int64(length%2)
+
+		switch chunkType {
+		case "VP8X", "VP8 ", "VP8L", "EXIF", "XMP ":
+			// only the headers of the image chunks are needed for the dimensions, and longer metadata chunks
+			// than any metadata are corrupt and skipped
+			n := int64(length)
+			switch {
+			case chunkType != "EXIF" && chunkType != "XMP ":
+				n = min(n, webpHeaderSize)
+			case n > maxMetadataChunk:
+				n = 0
+			}
+			data, err := readChunk(r, int64(length), n, padded-int64(length))
+			if err != nil {
+				return d, fmt.Errorf("failed to read webp %s chunk: %w", chunkType, err)
+			}
+			if len(data) > 0 {
+				d = addWebpChunk(d, chunkType, data)
+			}
+		default:
+			if _, err := r.Seek(padded, io.SeekCurrent); err != nil {
+				return d, fmt.Errorf("failed to seek webp chunk: %w", err)
+			}
+		}
+	}
+	return d, nil
+}
+
+// readChunk reads the first n bytes of a chunk of the length, seeking past the rest of it and the trailing bytes
+// after it such as a crc, so a bad length read from the file can't make a worker allocate gigabytes
+func readChunk(r io.ReadSeeker, length, n, trailing int64) ([]byte, error) {
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	_, err := r.Seek(length-n+trailing, io.SeekCurrent)
+	return data, err
+}
+
+func addWebpChunk(d decodedImage, chunkType string, data []byte) decodedImage {
+	switch chunkType {
+	case "VP8X":
+		// flags then the canvas width and height minus one as 24 bit values
+		if len(data) >= 10 {
+			d.width = int(uint32(data[4])|uint32(data[5])<<8|uint32(data[6])<<16) + 1
+			d.height = int(uint32(data[7])|uint32(data[8])<<8|uint32(data[9])<<16) + 1
+		}
+	case "VP8 ":
+		// frame tag and start code then 14 bit width and height
+		if len(data) >= 10 && d.width == 0 {
+			d.width = int(binary.LittleEndian.Uint16(data[6:8]) & 0x3fff)
+			d.height = int(binary.LittleEndian.Uint16(data[8:10]) & 0x3fff)
+		}
+	case "VP8L":
+		// signature then 14 bit width and height minus one
+		if len(data) >= 5 && d.width == 0 {
+			bits := binary.LittleEndian.Uint32(data[1:5])
+			d.width = int(bits&0x3fff) + 1
+			d.height = int((bits>>14)&0x3fff) + 1
+		}
+	case "EXIF":
+		return withExifPayload(d, data)
+	case "XMP ":
+		return withTextTimestamp(d, xmpDate(string(data)), "webp xmp")
+	}
+	return d
+}
+
+// withExifPayload decodes an exif block that has been embedded in another format,
+// keeping any dimensions already found
+func withExifPayload(d decodedImage, data []byte) decodedImage {
+	data = bytes.TrimPrefix(data, []byte("Exif\x00\x00"))
+	if len(data) == 0 {
+		return d
+	}
+
+	e, err := imagemeta.DecodeTiff(bytes.NewReader(data))
+	if err != nil {
+		return d
+	}
+	decoded := decodedFromExif(e)
+	if decoded.width == 0 {
+		decoded.width, decoded.height = d.width, d.height
+	}
+	if decoded.timestamp.IsZero() {
+		decoded.timestamp, decoded.timestampSource = d.timestamp, d.timestampSource
+	}
+	return decoded
+}
+
+// withTextTimestamp sets the timestamp from text if there isn't one from exif already
+func withTextTimestamp(d decodedImage, text, source string) decodedImage {
+	if !d.timestamp.IsZero() || text == "" {
+		return d
+	}
+	for _, layout := range textTimeLayouts {
+		t, err := time.Parse(layout, strings.TrimSpace(text))
+		if err == nil {
+			d.timestamp = t
+			d.timestampSource = source
+			return d
+		}
+	}
+	return d
+}
+
+func xmpDate(xmp string) string {
+	match := xmpDateRegex.FindStringSubmatch(xmp)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
@@ -0,0 +1,312 @@
+package image_manager
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+// exifTiff builds a little endian tiff with Make, Model and an exif ifd holding DateTimeOriginal
+func exifTiff(make, model, date string) []byte {
+	le := binary.LittleEndian
+	var b bytes.Buffer
+	b.WriteString("II*\x00")
+	binary.Write(&b, le, uint32(8))
+
+	const ifd0Size, exifIfdSize = 2 + 3*12 + 4, 2 + 12 + 4
+	exifIfd := uint32(8 + ifd0Size)
+	makeValue := append([]byte(make), 0)
+	modelValue := append([]byte(model), 0)
+	dateValue := append([]byte(date), 0)
+	makeOffset := exifIfd + exifIfdSize
+	modelOffset := makeOffset + uint32(len(makeValue))
+	dateOffset := modelOffset + uint32(len(modelValue))
+
+	entry := func(tag, typ uint16, count, value uint32) {
+		binary.Write(&b, le, tag)
+		binary.Write(&b, le, typ)
+		binary.Write(&b, le, count)
+		binary.Write(&b, le, value)
+	}
+	binary.Write(&b, le, uint16(3))
+	entry(0x010f, 2, uint32(len(makeValue)), makeOffset)
+	entry(0x0110, 2, uint32(len(modelValue)), modelOffset)
+	entry(0x8769, 4, 1, exifIfd)
+	binary.Write(&b, le, uint32(0))
+	binary.Write(&b, le, uint16(1))
+	entry(0x9003, 2, uint32(len(dateValue)), dateOffset)
+	binary.Write(&b, le, uint32(0))
+	b.Write(makeValue)
+	b.Write(modelValue)
+	b.Write(dateValue)
+	return b.Bytes()
+}
+
+func pngFile(chunks ...[]byte) []byte {
+	data := []byte("\x89PNG\r\n\x1a\n")
+	for _, c := range chunks {
+		data = append(data, c...)
+	}
+	return data
+}
+
+func pngChunk(chunkType string, data []byte) []byte {
+	c := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	c = append(c, chunkType...)
+	c = append(c, data...)
+	return binary.BigEndian.AppendUint32(c, crc32.ChecksumIEEE(c[4:]))
+}
+
+func pngHeader(width, height uint32) []byte {
+	data := binary.BigEndian.AppendUint32(nil, width)
+	data = binary.BigEndian.AppendUint32(data, height)
+	return pngChunk("IHDR", append(data, 8, 2, 0, 0, 0))
+}
+
+func compressed(text string) []byte {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	zw.Write([]byte(text))
+	zw.Close()
+	return b.Bytes()
+}
+
+func webpFile(chunks ...[]byte) []byte {
+	var body []byte
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(4+len(body)))...)
+	return append(append(data, "WEBP"...), body...)
+}
+
+func webpChunk(chunkType string, data []byte) []byte {
+	c := append([]byte(chunkType), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	c = append(c, data...)
+	if len(data)%2 == 1 {
+		c = append(c, 0)
+	}
+	return c
+}
+
+// webpCanvas being a VP8X chunk's flags then the canvas width and height minus one as 24 bit values
+func webpCanvas(width, height uint32) []byte {
+	data := make([]byte, 10)
+	data[4], data[5], data[6] = byte(width-1), byte((width-1)>>8), byte((width-1)>>16)
+	data[7], data[8], data[9] = byte(height-1), byte((height-1)>>8), byte((height-1)>>16)
+	return webpChunk("VP8X", data)
+}
+
+func TestDecodePng(t *testing.T) {
+	taken := time.Date(2021, 6, 5, 14, 30, 15, 0, time.UTC)
+	xmp := `<x:xmpmeta><rdf:Description xmp:CreateDate="2021-06-05T14:30:15"/></x:xmpmeta>`
+	tests := []struct {
+		name    string
+		data    []byte
+		make    string
+		source  string
+		width   int
+		height  int
+		wantErr bool
+	}{
+		{
+			name:   "eXIf",
+			data:   pngFile(pngHeader(640, 480), pngChunk("eXIf", exifTiff("Canon", "Canon EOS R6", "2021:06:05 14:30:15")), pngChunk("IEND", nil)),
+			make:   "Canon",
+			source: "exif DateTimeOriginal",
+			width:  640,
+			height: 480,
+		},
+		{
+			name:   "tEXt creation time",
+			data:   pngFile(pngHeader(1170, 2532), pngChunk("tEXt", []byte("Creation Time\x002021:06:05 14:30:15")), pngChunk("IEND", nil)),
+			source: "png Creation Time",
+			width:  1170,
+			height: 2532,
+		},
+		{
+			name: "compressed iTXt xmp",
+			data: pngFile(pngHeader(16, 16),
+				pngChunk("iTXt", append([]byte("XML:com.adobe.xmp\x00\x01\x00\x00\x00"), compressed(xmp)...)),
+				pngChunk("IEND", nil)),
+			source: "png xmp",
+			width:  16,
+			height: 16,
+		},
+		{
+			name:    "truncated chunk",
+			data:    pngFile(pngHeader(16, 16), pngChunk("tEXt", []byte("Creation Time\x002021:06:05 14:30:15"))[:20]),
+			wantErr: true,
+		},
+		{
+			name: "oversized chunk",
+			data: pngFile(pngHeader(16, 16),
+				append(binary.BigEndian.AppendUint32(nil, maxMetadataChunk+1), "tEXt"...)),
+			width:  16,
+			height: 16,
+		},
+		{
+			name:    "not a png",
+			data:    []byte("GIF89a"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := decodePng(bytes.NewReader(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if d.exif.Make != tt.make {
+				t.Errorf("got make %q, want %q", d.exif.Make, tt.make)
+			}
+			if tt.source != "" && (!d.timestamp.Equal(taken) || d.timestampSource != tt.source) {
+				t.Errorf("got timestamp %v from %q, want %v from %q", d.timestamp, d.timestampSource, taken, tt.source)
+			}
+			if tt.source == "" && !d.timestamp.IsZero() {
+				t.Errorf("got timestamp %v, want none", d.timestamp)
+			}
+			if d.width != tt.width || d.height != tt.height {
+				t.Errorf("got dimensions %dx%d, want %dx%d", d.width, d.height, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestDecodeWebp(t *testing.T) {
+	taken := time.Date(2021, 6, 5, 14, 30, 15, 0, time.UTC)
+	exif := exifTiff("Google", "Pixel 7", "2021:06:05 14:30:15")
+	tests := []struct {
+		name    string
+		data    []byte
+		make    string
+		width   int
+		height  int
+		wantErr bool
+	}{
+		{
+			name:   "VP8X",
+			data:   webpFile(webpCanvas(4000, 3000), webpChunk("VP8 ", make([]byte, 10))),
+			width:  4000,
+			height: 3000,
+		},
+		{
+			name:   "VP8",
+			data:   webpFile(webpChunk("VP8 ", []byte{0x50, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02, 0xe0, 0x01})),
+			width:  640,
+			height: 480,
+		},
+		{
+			// 14 bit width and height minus one, with an odd length so the chunk is padded
+			name:   "VP8L",
+			data:   webpFile(webpChunk("VP8L", []byte{0x2f, 0x7f, 0xc2, 0x77, 0x00})),
+			width:  640,
+			height: 480,
+		},
+		{
+			name:   "EXIF with prefix",
+			data:   webpFile(webpCanvas(640, 480), webpChunk("EXIF", append([]byte("Exif\x00\x00"), exif...))),
+			make:   "Google",
+			width:  640,
+			height: 480,
+		},
+		{
+			name:   "EXIF without prefix",
+			data:   webpFile(webpCanvas(640, 480), webpChunk("EXIF", exif)),
+			make:   "Google",
+			width:  640,
+			height: 480,
+		},
+		{
+			name:    "truncated chunk",
+			data:    webpFile(webpChunk("EXIF", exif)[:20]),
+			wantErr: true,
+		},
+		{
+			name:    "not a webp",
+			data:    pngFile(pngHeader(16, 16)),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := decodeWebp(bytes.NewReader(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if d.exif.Make != tt.make {
+				t.Errorf("got make %q, want %q", d.exif.Make, tt.make)
+			}
+			if tt.make != "" && !d.timestamp.Equal(taken) {
+				t.Errorf("got timestamp %v, want %v", d.timestamp, taken)
+			}
+			if d.width != tt.width || d.height != tt.height {
+				t.Errorf("got dimensions %dx%d, want %dx%d", d.width, d.height, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+// heifFile builds a heif with just an Exif item, its location in the meta box pointing into the mdat.
+// imagemeta looks for the item's "Exif" from 8 bytes before it, so image data comes first as in a real file
+func heifFile(exif []byte) []byte {
+	box := func(boxType string, data ...[]byte) []byte {
+		body := bytes.Join(data, nil)
+		b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+		return append(append(b, boxType...), body...)
+	}
+	version := func(v byte) []byte { return []byte{v, 0, 0, 0} }
+
+	ftyp := box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	hdlr := box("hdlr", version(0), make([]byte, 4), []byte("pict"), make([]byte, 12), []byte{0})
+	iinf := box("iinf", version(0), []byte{0, 1},
+		box("infe", version(2), []byte{0, 1, 0, 0}, []byte("Exif"), []byte{0}))
+	// the exif item being the offset to the tiff header then the header, imagemeta counts the 8 bytes before
+	// the tiff against the item's length so the item is padded as a camera's would be
+	item := bytes.Join([][]byte{{0, 0, 0, 6}, []byte("Exif\x00\x00"), exif, make([]byte, 16)}, nil)
+	iloc := func(offset uint32) []byte {
+		entry := []byte{0, 1, 0, 0, 0, 1}
+		entry = binary.BigEndian.AppendUint32(entry, offset)
+		entry = binary.BigEndian.AppendUint32(entry, uint32(len(item)))
+		return box("iloc", version(0), []byte{0x44, 0x00, 0, 1}, entry)
+	}
+	meta := box("meta", version(0), hdlr, iinf, iloc(0))
+	image := make([]byte, 16)
+	offset := uint32(len(ftyp) + len(meta) + 8 + len(image))
+	meta = box("meta", version(0), hdlr, iinf, iloc(offset))
+	return bytes.Join([][]byte{ftyp, meta, box("mdat", image, item)}, nil)
+}
+
+func TestDecodeHeif(t *testing.T) {
+	d, err := decodeHeif(bytes.NewReader(heifFile(exifTiff("Apple", "iPhone 12", "2021:06:05 14:30:15"))))
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if d.exif.Make != "Apple" || d.exif.Model != "iPhone 12" {
+		t.Errorf("got camera %q %q, want %q %q", d.exif.Make, d.exif.Model, "Apple", "iPhone 12")
+	}
+	if want := time.Date(2021, 6, 5, 14, 30, 15, 0, time.UTC); !d.timestamp.Equal(want) {
+		t.Errorf("got timestamp %v, want %v", d.timestamp, want)
+	}
+
+	if _, err := decodeHeif(bytes.NewReader(pngFile(pngHeader(16, 16)))); err == nil {
+		t.Error("got no error for a file that isn't a heif")
+	}
+}
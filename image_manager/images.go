@@ -2,44 +2,97 @@ package image_manager
 
 import (
 	"fmt"
-	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/evanoberholster/imagemeta"
-	"github.com/evanoberholster/imagemeta/exif2"
 	"go.uber.org/zap"
 
-	"github.com/photos-sorter/pkg/genutils"
+	"github.com/photos-sorter/pkg/clock"
+	"github.com/photos-sorter/pkg/geocode"
+	"github.com/photos-sorter/pkg/metadata"
+	"github.com/photos-sorter/pkg/quality"
 )
 
-var imageFileTypes = []string{"jpg", "jpeg", "raw", "cr3", "cr2"}
+// imageFileTypes being the non raw image types, raw types are in the raw format registry
+var imageFileTypes = []string{"jpg", "jpeg", "tif", "tiff", "heic", "heif", "png", "webp", "gif"}
+
+// sidecarFileTypes being edit settings saved alongside an image, such as from lightroom or dxo
+var sidecarFileTypes = []string{"xmp", "dop"}
 
 type ImageData struct {
-	fileName    string
-	filePath    string
-	cameraModel string
-	timestamp   time.Time
-	DestPath    string
+	fileName        string
+	filePath        string
+	cameraMake      string
+	cameraModel     string
+	cameraSerial    string
+	lens            string
+	software        string
+	width           int
+	height          int
+	timestamp       time.Time
+	timestampSource string
+	timeCorrected   bool
+	exposureBias    float64
+	autoBracket     bool
+	orientation     int
+	location        *metadata.Location
+	place           geocode.Place
+	site            string
+	event           string
+	quality         *quality.Scores
+	DestPath        string
 }
 
 func GetImageTypes() []string {
-	return imageFileTypes
-}
-
-func toImageData(e exif2.Exif, name, path string) ImageData {
-	h, m, s := e.DateTimeOriginal().Clock()
-	prefix := fmt.Sprintf("%s%s%s_",
-		genutils.PrefixZeros(2, strconv.Itoa(h)),
-		genutils.PrefixZeros(2, strconv.Itoa(m)),
-		genutils.PrefixZeros(2, strconv.Itoa(s)))
-	return ImageData{
-		fileName:    prefix + name,
-		filePath:    path,
-		cameraModel: e.Model,
-		timestamp:   e.DateTimeOriginal(),
+	return append(append([]string{}, imageFileTypes...), rawTypes...)
+}
+
+func GetSidecarTypes() []string {
+	return sidecarFileTypes
+}
+
+func toImageData(r metadata.Record, name, path string) ImageData {
+	i := ImageData{
+		fileName:        name,
+		filePath:        path,
+		cameraMake:      r.Make,
+		cameraModel:     r.Model,
+		cameraSerial:    r.CameraSerial,
+		lens:            r.Lens,
+		software:        r.Software,
+		width:           r.Width,
+		height:          r.Height,
+		timestamp:       r.Timestamp,
+		timestampSource: r.TimestampSource,
+		exposureBias:    r.ExposureBias,
+		autoBracket:     r.AutoBracket,
+		orientation:     r.Orientation,
+		location:        r.Location,
+	}
+	if i.timestamp.IsZero() {
+		i.timestampSource = "none"
 	}
+	return i
+}
+
+// CorrectTimestamp applies any matching clock offset to the image's timestamp,
+// this needs to happen before the file is renamed and the destination path is used
+func CorrectTimestamp(logger *zap.Logger, i ImageData, offsets []clock.Offset) ImageData {
+	corrected, ok := clock.Correct(offsets, i.GetCameraModel(), i.timestamp)
+	if !ok {
+		return i
+	}
+
+	logger.Debug("corrected image timestamp",
+		zap.String("fileName", i.fileName),
+		zap.String("cameraModel", i.GetCameraModel()),
+		zap.Time("original", i.timestamp),
+		zap.Time("corrected", corrected))
+	i.timestampSource += fmt.Sprintf(" corrected by %s", corrected.Sub(i.timestamp))
+	i.timestamp = corrected
+	i.timeCorrected = true
+	return i
 }
 
 func (i ImageData) GetFileName() string {
@@ -54,23 +107,138 @@ func (i ImageData) GetCameraModel() string {
 	return strings.ToLower(i.cameraModel)
 }
 
+func (i ImageData) GetCameraMake() string {
+	return strings.ToLower(i.cameraMake)
+}
+
+func (i ImageData) GetLens() string {
+	return i.lens
+}
+
+func (i ImageData) GetSoftware() string {
+	return i.software
+}
+
+func (i ImageData) GetDimensions() (int, int) {
+	return i.width, i.height
+}
+
+// GetExposureBias is the exposure compensation in EV
+func (i ImageData) GetExposureBias() float64 {
+	return i.exposureBias
+}
+
+// IsAutoBracket is whether the camera took the image as part of an auto exposure bracket
+func (i ImageData) IsAutoBracket() bool {
+	return i.autoBracket
+}
+
+// GetOrientation is the exif orientation, 1 being upright and 0 if it isn't known
+func (i ImageData) GetOrientation() int {
+	return i.orientation
+}
+
+// GetLocation is where the image was taken, if it has gps coordinates
+func (i ImageData) GetLocation() (metadata.Location, bool) {
+	if i.location == nil {
+		return metadata.Location{}, false
+	}
+	return *i.location, true
+}
+
+// GetPlace is the nearest known place to where the image was taken, empty without gps coordinates
+func (i ImageData) GetPlace() geocode.Place {
+	return i.place
+}
+
+// AddPlace looks up the nearest known place to the image's gps coordinates
+func AddPlace(logger *zap.Logger, i ImageData, geocoder *geocode.Geocoder) ImageData {
+	location, ok := i.GetLocation()
+	if !ok {
+		return i
+	}
+	place, ok := geocoder.Lookup(location)
+	if !ok {
+		logger.Debug("no known place near image",
+			zap.String("fileName", i.fileName),
+			zap.Float64("latitude", location.Latitude),
+			zap.Float64("longitude", location.Longitude))
+		return i
+	}
+	i.place = place
+	return i
+}
+
+func (i ImageData) GetCameraSerial() string {
+	return i.cameraSerial
+}
+
+// GetSite is the named site the image was taken at, if it matched one
+func (i ImageData) GetSite() string {
+	return i.site
+}
+
+// AddSite finds the named site the image was taken at, by its camera's serial number or gps coordinates
+func AddSite(logger *zap.Logger, i ImageData, sites geocode.Sites) ImageData {
+	location, hasLocation := i.GetLocation()
+	site, ok := sites.Find(i.cameraSerial, location, hasLocation)
+	if !ok {
+		return i
+	}
+	logger.Debug("found image site",
+		zap.String("fileName", i.fileName),
+		zap.String("cameraSerial", i.cameraSerial),
+		zap.String("site", site))
+	i.site = site
+	return i
+}
+
+// GetEvent is the name of the event the image was taken at, when events are being found
+func (i ImageData) GetEvent() string {
+	return i.event
+}
+
+func WithEvent(i ImageData, event string) ImageData {
+	i.event = event
+	return i
+}
+
+// GetQuality gets the image's sharpness and exposure scores, if it has been scored
+func (i ImageData) GetQuality() (quality.Scores, bool) {
+	if i.quality == nil {
+		return quality.Scores{}, false
+	}
+	return *i.quality, true
+}
+
+func WithQuality(i ImageData, scores quality.Scores) ImageData {
+	i.quality = &scores
+	return i
+}
+
+func (i ImageData) IsTimeCorrected() bool {
+	return i.timeCorrected
+}
+
+// GetTimestampSource describes where the timestamp came from and any correction to it
+func (i ImageData) GetTimestampSource() string {
+	return i.timestampSource
+}
+
 func GetTimestamp(i ImageData) time.Time {
 	return i.timestamp
 }
 
-func GetPhoto(_ *zap.Logger, path string) (ImageData, error) {
-	var i ImageData
-	f, err := os.Open(path)
-	if err != nil {
-		return i, fmt.Errorf("failed to open file: %w", err)
-	}
-	defer f.Close()
+// PhotoFromMetadata makes the image data from metadata that has already been extracted, such as in a batch
+func PhotoFromMetadata(path string, r metadata.Record) ImageData {
+	return toImageData(r, filepath.Base(path), path)
+}
 
-	e, err := imagemeta.Decode(f)
+// GetPhoto reads the image's metadata with the extractor, which picks the backend for the file type
+func GetPhoto(logger *zap.Logger, extractor metadata.Extractor, path string) (ImageData, error) {
+	r, err := extractor.Extract(logger, path)
 	if err != nil {
-		return i, fmt.Errorf("failed to decode image: %w", err)
+		return ImageData{}, fmt.Errorf("failed to decode image: %w", err)
 	}
-
-	sepPath := strings.Split(path, "/")
-	return toImageData(e, sepPath[len(sepPath)-1], path), nil
+	return toImageData(r, filepath.Base(path), path), nil
 }
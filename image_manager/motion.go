@@ -0,0 +1,187 @@
+package image_manager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// xmpHeaderSize is how much of the start of a jpeg is checked for google's motion photo xmp
+	xmpHeaderSize = 64 * 1024
+	// mp4SearchWindow is how much of a motion photo is read at a time when searching for its video
+	mp4SearchWindow = 1 << 20
+	// mp4BoxHeaderSize being an ftyp box's size, type and major brand
+	mp4BoxHeaderSize = 12
+)
+
+var (
+	ErrVideoExists = errors.New("video file already exists")
+
+	// livePhotoStillTypes being the stills that apple pairs with a short mov
+	livePhotoStillTypes = []string{"heic", "heif", "jpg", "jpeg"}
+
+	motionPhotoNameRegex  = regexp.MustCompile(`(?i)^(mvimg_.*|pxl_.*\.mp)\.jpe?g$`)
+	motionPhotoXmpMarkers = [][]byte{
+		[]byte("GCamera:MotionPhoto"),
+		[]byte("GCamera:MicroVideo"),
+		[]byte("Camera:MotionPhoto"),
+	}
+	motionPhotoLengthRegexes = []*regexp.Regexp{
+		regexp.MustCompile(`GCamera:MicroVideoOffset(?:="|>)(\d+)`),
+		regexp.MustCompile(`Item:Semantic="MotionPhoto"[^>]*?Item:Length="(\d+)"`),
+	}
+	mp4Brands = [][]byte{[]byte("mp4"), []byte("isom"), []byte("iso"), []byte("avc1"), []byte("qt  ")}
+)
+
+func GetLivePhotoStillTypes() []string {
+	return livePhotoStillTypes
+}
+
+// MotionPhotoVideo is where the video is embedded in a google motion photo
+type MotionPhotoVideo struct {
+	Offset int64
+	Length int64
+}
+
+// FindMotionPhotoVideo checks if a jpeg is a google motion photo, either by its name or its xmp,
+// and finds the mp4 appended after the jpeg data, from the xmp's offset or by searching back from the end
+func FindMotionPhotoVideo(path string) (MotionPhotoVideo, bool, error) {
+	name := filepath.Base(path)
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	if ext != "jpg" && ext != "jpeg" {
+		return MotionPhotoVideo{}, false, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return MotionPhotoVideo{}, false, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return MotionPhotoVideo{}, false, fmt.Errorf("failed to stat file: %w", err)
+	}
+	size := info.Size()
+
+	header := make([]byte, min(xmpHeaderSize, size))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return MotionPhotoVideo{}, false, fmt.Errorf("failed to read file: %w", err)
+	}
+	if !motionPhotoNameRegex.MatchString(name) && !hasMotionPhotoXmp(header) {
+		return MotionPhotoVideo{}, false, nil
+	}
+
+	if length, ok := xmpVideoLength(header); ok && length < size {
+		box := make([]byte, mp4BoxHeaderSize)
+		if _, err := f.ReadAt(box, size-length); err == nil && isMp4Box(box) {
+			return MotionPhotoVideo{Offset: size - length, Length: length}, true, nil
+		}
+	}
+
+	offset, ok, err := findTrailingMp4(f, size)
+	if err != nil || !ok {
+		return MotionPhotoVideo{}, false, err
+	}
+	return MotionPhotoVideo{Offset: offset, Length: size - offset}, true, nil
+}
+
+// ExtractMotionPhotoVideo copies the embedded mp4 from a motion photo into its own file,
+// returning ErrVideoExists rather than overwriting a video already at dst
+func ExtractMotionPhotoVideo(path string, video MotionPhotoVideo, dst string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open motion photo: %w", err)
+	}
+	defer src.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return ErrVideoExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create video file: %w", err)
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, io.NewSectionReader(src, video.Offset, video.Length))
+	if err != nil {
+		return fmt.Errorf("failed to copy embedded video: %w", err)
+	}
+	return out.Sync()
+}
+
+func hasMotionPhotoXmp(header []byte) bool {
+	for _, marker := range motionPhotoXmpMarkers {
+		if bytes.Contains(header, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// xmpVideoLength gets how far from the end of the file the video starts from the motion photo xmp,
+// either the older MicroVideoOffset or the length of the container's MotionPhoto item
+func xmpVideoLength(header []byte) (int64, bool) {
+	for _, regex := range motionPhotoLengthRegexes {
+		match := regex.FindSubmatch(header)
+		if match == nil {
+			continue
+		}
+		length, err := strconv.ParseInt(string(match[1]), 10, 64)
+		if err == nil && length > 0 {
+			return length, true
+		}
+	}
+	return 0, false
+}
+
+// findTrailingMp4 searches back from the end of the file for the ftyp box with an mp4 brand that starts the
+// video, reading a window at a time so the whole file isn't read into memory. The windows overlap by a box
+// header so one can't be missed across them
+func findTrailingMp4(r io.ReaderAt, size int64) (int64, bool, error) {
+	buf := make([]byte, mp4SearchWindow)
+	for end := size; end > mp4BoxHeaderSize; {
+		start := max(end-mp4SearchWindow, 0)
+		window := buf[:end-start]
+		if _, err := r.ReadAt(window, start); err != nil && err != io.EOF {
+			return 0, false, fmt.Errorf("failed to read file: %w", err)
+		}
+		for i := len(window) - mp4BoxHeaderSize; i >= 0; i-- {
+			// the video can't start at the start of the file, that would be the jpeg
+			if start+int64(i) > 0 && isMp4Box(window[i:]) {
+				return start + int64(i), true, nil
+			}
+		}
+		if start == 0 {
+			break
+		}
+		end = start + mp4BoxHeaderSize - 1
+	}
+	return 0, false, nil
+}
+
+// isMp4Box checks whether data starts with an ftyp box header with an mp4 brand
+func isMp4Box(data []byte) bool {
+	if len(data) < mp4BoxHeaderSize || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	boxSize := binary.BigEndian.Uint32(data[0:4])
+	if boxSize < 8 || boxSize > 256 {
+		return false
+	}
+	for _, mp4Brand := range mp4Brands {
+		if bytes.HasPrefix(data[8:12], mp4Brand) {
+			return true
+		}
+	}
+	return false
+}
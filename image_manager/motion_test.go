@@ -0,0 +1,65 @@
+package image_manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindMotionPhotoVideo(t *testing.T) {
+	video := append([]byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isommp41"), bytes.Repeat([]byte{7}, 1000)...)
+	still := func(xmp string) []byte {
+		return append(append([]byte("\xff\xd8"), xmp...), bytes.Repeat([]byte{1}, 5000)...)
+	}
+	tests := []struct {
+		name  string
+		data  []byte
+		found bool
+	}{
+		{name: "MVIMG_20210605_143015.jpg", data: append(still(""), video...), found: true},
+		{name: "offset.jpg", data: append(still(fmt.Sprintf(`GCamera:MicroVideo="1" GCamera:MicroVideoOffset="%d"`,
+			len(video))), video...), found: true},
+		{name: "container.jpg", data: append(still(fmt.Sprintf(`GCamera:MotionPhoto="1" `+
+			`<Container:Item Item:Mime="video/mp4" Item:Semantic="MotionPhoto" Item:Length="%d"/>`, len(video))), video...),
+			found: true},
+		{name: "not_motion.jpg", data: append(still(""), video...)},
+		{name: "MVIMG_no_video.jpg", data: still("")},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			v, ok, err := FindMotionPhotoVideo(path)
+			if err != nil {
+				t.Fatalf("failed to find video: %v", err)
+			}
+			if ok != tt.found {
+				t.Fatalf("got found %v, want %v", ok, tt.found)
+			}
+			if !ok {
+				return
+			}
+			if want := int64(len(tt.data) - len(video)); v.Offset != want || v.Length != int64(len(video)) {
+				t.Errorf("got video at %d of %d bytes, want %d of %d", v.Offset, v.Length, want, len(video))
+			}
+
+			dst := path + ".mp4"
+			if err := ExtractMotionPhotoVideo(path, v, dst); err != nil {
+				t.Fatalf("failed to extract video: %v", err)
+			}
+			if extracted, _ := os.ReadFile(dst); !bytes.Equal(extracted, video) {
+				t.Error("extracted video doesn't match")
+			}
+			if err := ExtractMotionPhotoVideo(path, v, dst); !errors.Is(err, ErrVideoExists) {
+				t.Errorf("got %v extracting over an existing video, want ErrVideoExists", err)
+			}
+		})
+	}
+}
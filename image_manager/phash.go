@@ -0,0 +1,93 @@
+package image_manager
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/photos-sorter/pkg/duplicate"
+)
+
+// pHashSize being the grid the discrete cosine transform is taken over, of which the
+// lowest 8x8 frequencies make the hash
+const pHashSize = 32
+
+// PerceptualHash being a 64 bit hash of what an image looks like, so copies at a different size
+// or compression have hashes only a few bits apart, along with the size of the pixels it was made from
+type PerceptualHash struct {
+	Value  uint64
+	Width  int
+	Height int
+}
+
+// Distance is the number of bits that differ between the hashes, 0 being visually identical
+func (h PerceptualHash) Distance(other PerceptualHash) int {
+	return bits.OnesCount64(h.Value ^ other.Value)
+}
+
+// GetPerceptualHash hashes the image's pixels, or its embedded preview for raws, turned upright first
+// so a copy that has been rotated rather than having an orientation tag still matches
+func GetPerceptualHash(i ImageData, algorithm string) (PerceptualHash, error) {
+	img, err := decodePixels(i.filePath)
+	if err != nil {
+		return PerceptualHash{}, err
+	}
+
+	h := PerceptualHash{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+	switch algorithm {
+	case duplicate.DHash:
+		h.Value = dHash(grayscale(img, 9, i.orientation))
+	case duplicate.PHash:
+		h.Value = pHash(grayscale(img, pHashSize, i.orientation))
+	default:
+		return h, fmt.Errorf("unknown perceptual hash: %s", algorithm)
+	}
+	return h, nil
+}
+
+// dHash sets a bit for each pixel brighter than the one to its right, in an 9x8 grid
+func dHash(grid [][]float64) uint64 {
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if grid[y][x] > grid[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// pHash sets a bit for each of the lowest 8x8 frequencies above their median, skipping the average brightness
+func pHash(grid [][]float64) uint64 {
+	n := len(grid)
+	coefficients := make([]float64, 0, 64)
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				for x := 0; x < n; x++ {
+					sum += grid[y][x] *
+						math.Cos(float64(2*x+1)*float64(u)*math.Pi/float64(2*n)) *
+						math.Cos(float64(2*y+1)*float64(v)*math.Pi/float64(2*n))
+				}
+			}
+			coefficients = append(coefficients, sum)
+		}
+	}
+
+	sorted := append([]float64{}, coefficients[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for _, c := range coefficients {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
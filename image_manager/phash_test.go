@@ -0,0 +1,134 @@
+package image_manager
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/bits"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/photos-sorter/pkg/duplicate"
+)
+
+// scene draws a width by height image of an 8x6 grid of blocks, their brightness picked by the seed
+func scene(width, height int, seed int64) *image.Gray {
+	r := rand.New(rand.NewSource(seed))
+	var levels [6][8]uint8
+	for y := range levels {
+		for x := range levels[y] {
+			levels[y][x] = uint8(r.Intn(256))
+		}
+	}
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: levels[y*6/height][x*8/width]})
+		}
+	}
+	return img
+}
+
+// rotated stores the image turned 90 degrees anticlockwise, as a camera would with orientation 6
+func rotated(img *image.Gray) *image.Gray {
+	b := img.Bounds()
+	r := image.NewGray(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			r.SetGray(y, b.Dx()-1-x, img.GrayAt(x, y))
+		}
+	}
+	return r
+}
+
+func TestDHash(t *testing.T) {
+	grid := func(brighterLeft bool) [][]float64 {
+		g := make([][]float64, 9)
+		for y := range g {
+			g[y] = make([]float64, 9)
+			for x := range g[y] {
+				g[y][x] = float64(x * 10)
+				if brighterLeft {
+					g[y][x] = float64(90 - x*10)
+				}
+			}
+		}
+		return g
+	}
+	if h := dHash(grid(true)); h != ^uint64(0) {
+		t.Errorf("got %016x for a grid getting darker to the right, want every bit set", h)
+	}
+	if h := dHash(grid(false)); h != 0 {
+		t.Errorf("got %016x for a grid getting brighter to the right, want no bits set", h)
+	}
+}
+
+func TestPHash(t *testing.T) {
+	grid := grayscale(scene(320, 240, 1), pHashSize, 1)
+	h := pHash(grid)
+	if n := bits.OnesCount64(h); n < 16 || n > 48 {
+		t.Errorf("got %016x with %d bits set, want about half set around the median", h, n)
+	}
+
+	// the average brightness isn't part of the hash, so a brighter copy has the same hash
+	for _, row := range grid {
+		for x := range row {
+			row[x] += 20
+		}
+	}
+	if brighter := pHash(grid); brighter != h {
+		t.Errorf("got %016x for a brighter copy, want %016x", brighter, h)
+	}
+}
+
+func TestGetPerceptualHash(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, img image.Image, quality int) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := jpeg.Encode(f, img, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	original := ImageData{filePath: write("original.jpg", scene(640, 480, 1), 95)}
+	copies := []struct {
+		name  string
+		image ImageData
+		same  bool
+	}{
+		{name: "smaller and compressed", image: ImageData{filePath: write("small.jpg", scene(320, 240, 1), 40)}, same: true},
+		{name: "stored rotated", image: ImageData{filePath: write("rotated.jpg", rotated(scene(640, 480, 1)), 80), orientation: 6}, same: true},
+		{name: "another photo", image: ImageData{filePath: write("other.jpg", scene(640, 480, 2), 95)}},
+	}
+
+	for _, algorithm := range duplicate.Algorithms {
+		want, err := GetPerceptualHash(original, algorithm)
+		if err != nil {
+			t.Fatalf("failed to hash with %s: %v", algorithm, err)
+		}
+		if want.Width != 640 || want.Height != 480 {
+			t.Errorf("got %s hash of %dx%d pixels, want 640x480", algorithm, want.Width, want.Height)
+		}
+		for _, c := range copies {
+			h, err := GetPerceptualHash(c.image, algorithm)
+			if err != nil {
+				t.Fatalf("failed to hash %s with %s: %v", c.name, algorithm, err)
+			}
+			if d := h.Distance(want); (d <= 6) != c.same {
+				t.Errorf("got %s %s %d bits from the original, want same photo %v", algorithm, c.name, d, c.same)
+			}
+		}
+	}
+
+	if _, err := GetPerceptualHash(original, "ahash"); err == nil {
+		t.Error("got no error for an unknown algorithm")
+	}
+}
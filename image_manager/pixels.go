@@ -0,0 +1,165 @@
+package image_manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+
+	"github.com/photos-sorter/pkg/genutils"
+	"github.com/photos-sorter/pkg/metadata"
+)
+
+// maxPreviewScan being how much of a file is searched for an embedded jpeg preview
+const maxPreviewScan = 64 << 20
+
+var (
+	ErrNoPixels = errors.New("no decodable image or embedded preview")
+
+	jpegStart = []byte{0xff, 0xd8, 0xff}
+
+	// pixelTypes being the formats the standard library decodes, others use their largest embedded jpeg
+	pixelTypes = []string{"jpg", "jpeg", "png", "gif"}
+)
+
+// decodePixels decodes the image, or for raws and formats go can't decode its largest embedded jpeg preview
+func decodePixels(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	if genutils.InArray(pixelTypes, metadata.Ext(path)) {
+		img, _, err := image.Decode(f)
+		if err == nil {
+			return img, nil
+		}
+		// some jpegs go can't decode, such as arithmetic coded ones, may still have an exif thumbnail
+		_, err = f.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, fmt.Errorf("failed to seek file: %w", err)
+		}
+	}
+	return decodeEmbeddedPreview(f)
+}
+
+// decodeEmbeddedPreview finds the largest jpeg embedded in the file, such as a raw's preview
+// or a jpeg's exif thumbnail
+func decodeEmbeddedPreview(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxPreviewScan))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	best, bestPixels := -1, 0
+	for offset := 1; offset < len(data); {
+		i := bytes.Index(data[offset:], jpegStart)
+		if i == -1 {
+			break
+		}
+		start := offset + i
+		offset = start + len(jpegStart)
+
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(data[start:]))
+		if err != nil || cfg.Width*cfg.Height <= bestPixels {
+			continue
+		}
+		best, bestPixels = start, cfg.Width*cfg.Height
+	}
+	if best == -1 {
+		return nil, ErrNoPixels
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data[best:]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode embedded preview: %w", err)
+	}
+	return img, nil
+}
+
+// grayscale averages the image down to a size by size grid of luminance, turned upright by its exif orientation
+func grayscale(img image.Image, size, orientation int) [][]float64 {
+	return orient(luminance(img, size, size), orientation)
+}
+
+// luminance averages the image down to a width by height grid of luminance from 0 to 255
+func luminance(img image.Image, width, height int) [][]float64 {
+	b := img.Bounds()
+	sums := make([][]float64, height)
+	counts := make([][]int, height)
+	for y := range sums {
+		sums[y] = make([]float64, width)
+		counts[y] = make([]int, width)
+	}
+
+	add := func(x, y int, luma float64) {
+		gx := (x - b.Min.X) * width / b.Dx()
+		gy := (y - b.Min.Y) * height / b.Dy()
+		sums[gy][gx] += luma
+		counts[gy][gx]++
+	}
+	if ycbcr, ok := img.(*image.YCbCr); ok {
+		// reading the luma plane directly is much faster than converting each pixel
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				add(x, y, float64(ycbcr.Y[ycbcr.YOffset(x, y)]))
+			}
+		}
+	} else {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, bl, _ := img.At(x, y).RGBA()
+				add(x, y, (0.299*float64(r)+0.587*float64(g)+0.114*float64(bl))/257)
+			}
+		}
+	}
+
+	grid := make([][]float64, height)
+	for y := range grid {
+		grid[y] = make([]float64, width)
+		for x := range grid[y] {
+			if counts[y][x] > 0 {
+				grid[y][x] = sums[y][x] / float64(counts[y][x])
+			}
+		}
+	}
+	return grid
+}
+
+// orient turns a square grid upright by the exif orientation, 6 being rotated 90 degrees clockwise
+func orient(grid [][]float64, orientation int) [][]float64 {
+	n := len(grid)
+	oriented := make([][]float64, n)
+	for y := range oriented {
+		oriented[y] = make([]float64, n)
+		for x := range oriented[y] {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = n-1-x, y
+			case 3:
+				sx, sy = n-1-x, n-1-y
+			case 4:
+				sx, sy = x, n-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, n-1-x
+			case 7:
+				sx, sy = n-1-y, n-1-x
+			case 8:
+				sx, sy = n-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			oriented[y][x] = grid[sy][sx]
+		}
+	}
+	return oriented
+}
@@ -0,0 +1,65 @@
+package image_manager
+
+import (
+	"github.com/photos-sorter/pkg/quality"
+)
+
+const (
+	// qualitySize being the longest side an image is scaled down to before it is scored, so the sharpness
+	// of a full size jpeg can be compared with a raw's smaller preview
+	qualitySize = 1024
+
+	// shadowLevel and highlightLevel being the luminance at or past which a pixel counts as clipped
+	shadowLevel    = 3
+	highlightLevel = 252
+)
+
+// GetQualityScores scores how sharp and well exposed the image is, from its pixels or for raws its embedded preview
+func GetQualityScores(i ImageData) (quality.Scores, error) {
+	img, err := decodePixels(i.filePath)
+	if err != nil {
+		return quality.Scores{}, err
+	}
+
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if longest := max(width, height); longest > qualitySize {
+		width = max(width*qualitySize/longest, 1)
+		height = max(height*qualitySize/longest, 1)
+	}
+	grid := luminance(img, width, height)
+
+	var s quality.Scores
+	for _, row := range grid {
+		for _, l := range row {
+			if l <= shadowLevel {
+				s.Shadows++
+			}
+			if l >= highlightLevel {
+				s.Highlights++
+			}
+		}
+	}
+	s.Shadows /= float64(width * height)
+	s.Highlights /= float64(width * height)
+	s.Sharpness = laplacianVariance(grid)
+	return s, nil
+}
+
+// laplacianVariance is the variance of the edges found by a 3x3 laplacian, a blurry image has few strong edges
+func laplacianVariance(grid [][]float64) float64 {
+	var sum, sumSquares float64
+	var n int
+	for y := 1; y < len(grid)-1; y++ {
+		for x := 1; x < len(grid[y])-1; x++ {
+			l := grid[y-1][x] + grid[y+1][x] + grid[y][x-1] + grid[y][x+1] - 4*grid[y][x]
+			sum += l
+			sumSquares += l * l
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	mean := sum / float64(n)
+	return sumSquares/float64(n) - mean*mean
+}
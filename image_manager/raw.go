@@ -0,0 +1,154 @@
+package image_manager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/evanoberholster/imagemeta"
+)
+
+var (
+	ErrNotRaf = errors.New("not a fujifilm raf file")
+
+	// rawFormats is the registry of camera raw formats, keyed by lower case file extension
+	rawFormats = map[string]RawFormat{
+		"raw": {Manufacturer: "generic", decode: decodeExif},
+		"cr2": {Manufacturer: "Canon", decode: decodeExif},
+		"cr3": {Manufacturer: "Canon", decode: decodeExif},
+		"dng": {Manufacturer: "Adobe", decode: decodeExif},
+		"nef": {Manufacturer: "Nikon", decode: decodeTiffRaw},
+		"nrw": {Manufacturer: "Nikon", decode: decodeTiffRaw},
+		"arw": {Manufacturer: "Sony", decode: decodeTiffRaw},
+		"srf": {Manufacturer: "Sony", decode: decodeTiffRaw},
+		"pef": {Manufacturer: "Pentax", decode: decodeTiffRaw},
+		"3fr": {Manufacturer: "Hasselblad", decode: decodeTiffRaw},
+		"orf": {Manufacturer: "Olympus", decode: decodePatchedTiffRaw},
+		"rw2": {Manufacturer: "Panasonic", decode: decodePatchedTiffRaw},
+		"raf": {Manufacturer: "Fujifilm", decode: decodeRaf},
+	}
+
+	// rawTypes in a fixed order for discovery
+	rawTypes = []string{"raw", "cr2", "cr3", "dng", "nef", "nrw", "arw", "srf", "pef", "3fr", "orf", "rw2", "raf"}
+)
+
+// RawFormat is a camera raw format that can be sorted, with how to read its metadata
+type RawFormat struct {
+	Manufacturer string
+	decode       func(io.ReadSeeker) (decodedImage, error)
+}
+
+func init() {
+	for ext, format := range rawFormats {
+		imageDecoders[ext] = format.decode
+	}
+}
+
+func GetRawTypes() []string {
+	return rawTypes
+}
+
+// IsRawType checks if the extension, with or without the dot, is a registered raw format
+func IsRawType(ext string) bool {
+	_, ok := rawFormats[strings.ToLower(strings.TrimPrefix(ext, "."))]
+	return ok
+}
+
+// decodeTiffRaw reads raw formats that are tiff files with a standard header,
+// imagemeta's generic Decode doesn't accept these image types
+func decodeTiffRaw(r io.ReadSeeker) (decodedImage, error) {
+	e, err := imagemeta.DecodeTiff(r)
+	if err != nil {
+		return decodedImage{}, err
+	}
+	return decodedFromExif(e), nil
+}
+
+// decodePatchedTiffRaw reads raw formats that are tiff files with their own header magic,
+// such as "IIRO" for olympus and "IIU" for panasonic, by reading them with the standard magic
+func decodePatchedTiffRaw(r io.ReadSeeker) (decodedImage, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return decodedImage{}, fmt.Errorf("failed to read raw header: %w", err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return decodedImage{}, fmt.Errorf("failed to seek raw header: %w", err)
+	}
+
+	switch string(header[0:2]) {
+	case "II":
+		header = []byte("II*\x00")
+	case "MM":
+		header = []byte("MM\x00*")
+	default:
+		return decodedImage{}, fmt.Errorf("unknown raw byte order %q", header[0:2])
+	}
+	return decodeTiffRaw(&patchedHeaderReader{ReadSeeker: r, header: header})
+}
+
+// decodeRaf reads the exif from the jpeg preview embedded in a fujifilm raf,
+// whose offset and length are big endian values at bytes 84 and 88 of the header
+func decodeRaf(r io.ReadSeeker) (decodedImage, error) {
+	header := make([]byte, 92)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.HasPrefix(header, []byte("FUJIFILMCCD-RAW")) {
+		return decodedImage{}, ErrNotRaf
+	}
+
+	offset := int64(binary.BigEndian.Uint32(header[84:88]))
+	length := int64(binary.BigEndian.Uint32(header[88:92]))
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return decodedImage{}, fmt.Errorf("failed to seek raf: %w", err)
+	}
+	if offset+length > size {
+		return decodedImage{}, fmt.Errorf("raf jpeg at %d of length %d is past the end of the file", offset, length)
+	}
+
+	e, err := imagemeta.DecodeJPEG(io.NewSectionReader(readerAt{r}, offset, length))
+	if err != nil {
+		return decodedImage{}, err
+	}
+	return decodedFromExif(e), nil
+}
+
+// readerAt reads at an offset by seeking, so a preview can be read from within the file without copying it
+type readerAt struct {
+	io.ReadSeeker
+}
+
+func (r readerAt) ReadAt(p []byte, off int64) (int, error) {
+	if ra, ok := r.ReadSeeker.(io.ReaderAt); ok {
+		return ra.ReadAt(p, off)
+	}
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(r.ReadSeeker, p)
+}
+
+// patchedHeaderReader replaces the first bytes of the underlying reader with header
+type patchedHeaderReader struct {
+	io.ReadSeeker
+	header []byte
+	pos    int64
+}
+
+func (r *patchedHeaderReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	for i := 0; i < n && r.pos+int64(i) < int64(len(r.header)); i++ {
+		p[i] = r.header[r.pos+int64(i)]
+	}
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *patchedHeaderReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.ReadSeeker.Seek(offset, whence)
+	if err == nil {
+		r.pos = pos
+	}
+	return pos, err
+}
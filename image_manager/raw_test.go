@@ -0,0 +1,82 @@
+package image_manager
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRawFormats(t *testing.T) {
+	taken := time.Date(2021, 6, 5, 14, 30, 15, 0, time.UTC)
+	tests := []struct {
+		ext   string
+		make  string
+		model string
+		// taken being when the fixture was taken if not the synthesized fixtures' time
+		taken time.Time
+	}{
+		{ext: "raw", make: "Generic", model: "Camera"},
+		{ext: "cr2", make: "Canon", model: "Canon EOS 5D Mark II"},
+		{ext: "cr3", make: "Canon", model: "Canon EOS R6",
+			taken: time.Date(2020, 7, 6, 15, 32, 17, 82e6, time.FixedZone("", -8*60*60))},
+		{ext: "dng", make: "Adobe", model: "DNG Camera"},
+		{ext: "nef", make: "Nikon", model: "NIKON D90"},
+		{ext: "nrw", make: "Nikon", model: "COOLPIX P7000"},
+		{ext: "arw", make: "Sony", model: "ILCE-7M3"},
+		{ext: "srf", make: "Sony", model: "DSLR-A100"},
+		{ext: "pef", make: "PENTAX", model: "PENTAX K-5"},
+		{ext: "3fr", make: "Hasselblad", model: "H3D-39"},
+		{ext: "orf", make: "OLYMPUS CORPORATION", model: "E-M1"},
+		{ext: "rw2", make: "Panasonic", model: "DMC-GH4"},
+		{ext: "raf", make: "FUJIFILM", model: "X-T2"},
+	}
+
+	tested := make(map[string]bool)
+	for _, tt := range tests {
+		tested[tt.ext] = true
+		t.Run(tt.ext, func(t *testing.T) {
+			format, ok := rawFormats[tt.ext]
+			if !ok {
+				t.Fatalf("%s isn't a registered raw format", tt.ext)
+			}
+			f, err := os.Open(filepath.Join("testdata", "sample."+tt.ext))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			d, err := format.decode(f)
+			if err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if d.exif.Make != tt.make || d.exif.Model != tt.model {
+				t.Errorf("got camera %q %q, want %q %q", d.exif.Make, d.exif.Model, tt.make, tt.model)
+			}
+			want := taken
+			if !tt.taken.IsZero() {
+				want = tt.taken
+			}
+			if !d.timestamp.Equal(want) {
+				t.Errorf("got timestamp %v, want %v", d.timestamp, want)
+			}
+		})
+	}
+
+	for _, ext := range GetRawTypes() {
+		if !tested[ext] {
+			t.Errorf("raw format %s has no test", ext)
+		}
+	}
+}
+
+func TestDecodeRafPastEnd(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sample.raf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeRaf(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Error("got no error for a preview past the end of the file")
+	}
+}
@@ -1,28 +1,39 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/photos-sorter/file_manager"
-	"github.com/photos-sorter/image_manager"
 	"github.com/photos-sorter/pkg/config"
+	"github.com/photos-sorter/pkg/event"
 	"github.com/photos-sorter/pkg/logging"
+	"github.com/photos-sorter/pkg/progress"
 	"github.com/photos-sorter/sorting"
 	"github.com/photos-sorter/zip_manager"
 )
 
 const (
-	videoMode = "videos"
-	imageMode = "images"
+	videoMode    = "videos"
+	imageMode    = "images"
+	nonMediaMode = "non-media"
 
 	moveFileMode = "move"
 	copyFileMode = "copy"
 
 	mode     = "images"
 	fileMode = "copy"
+
+	explainCommand = "explain"
+	labelCommand   = "label"
 )
 
 //todo look at uploading to google photos
@@ -30,12 +41,23 @@ const (
 //todo double check it won't try copying a file that is already there (log this)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == explainCommand {
+		explain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == labelCommand {
+		label(os.Args[2:])
+		return
+	}
+
 	cfg, err := config.GetConfig()
 	if err != nil {
 		log.Fatal("failed to get config", zap.Error(err))
 	}
 
-	logger := logging.NewLogger(cfg.LogLevel)
+	// the progress is a bar on a terminal, with the logs written above it, or otherwise logged every so often
+	display := progress.NewDisplay(os.Stdout, file_manager.Progress)
+	logger := logging.NewLoggerTo(cfg.LogLevel, display.Output())
 	logger.Info("Started photos sorter",
 		zap.String("sourcePath", cfg.SourcePath),
 		zap.String("destinationPath", cfg.DestinationPath),
@@ -45,6 +67,12 @@ func main() {
 
 	startTime := time.Now()
 
+	// stopping on ctrl-c or a kill lets the sort finish its current file and close the exiftool processes
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stopProgress := display.Start(ctx, logger)
+	defer stopProgress()
+
 	if cfg.IncludeZips {
 		fileList, err := zip_manager.UnzipFileFromZip(logger, cfg.SourcePath, cfg.DestinationPath)
 		if err != nil {
@@ -69,85 +97,87 @@ func main() {
 
 	switch cfg.FileType {
 	case imageMode:
-		err = sorting.SortImages(logger, cfg, moveFileFunc)
+		err = sorting.SortImages(ctx, logger, cfg, moveFileFunc)
 	case videoMode:
-		err = sorting.SortVideos(logger, cfg)
+		err = sorting.SortVideos(ctx, logger, cfg)
+	case nonMediaMode:
+		err = sorting.SortNonMedia(ctx, logger, cfg, moveFileFunc)
 	default:
 		logger.Fatal("invalid mode selected", zap.String("mode", cfg.FileMode))
 	}
+	stopProgress()
+	counts := file_manager.Progress.Snapshot(time.Now())
+	if errors.Is(err, context.Canceled) {
+		logger.Warn("Interrupted, stopped sorting",
+			zap.Duration("runTime", time.Since(startTime)),
+			zap.Int64("filesMoved", counts.Copied))
+		stop()
+		os.Exit(1)
+	}
 	if err != nil {
 		logger.Fatal("failed to sort files", zap.Error(err))
 	}
 
 	logger.Info("Finished photos sorter",
 		zap.Duration("runTime", time.Since(startTime)),
-		zap.Int("filesMoved", file_manager.ReturnFilesCount()),
-		zap.Int("entriesChecked", file_manager.ReturnEntriesCheckedCount()))
+		zap.Int64("filesFound", counts.Discovered),
+		zap.Int64("filesMoved", counts.Copied),
+		zap.Int64("skipped", counts.Skipped),
+		zap.Int64("failed", counts.Failed))
 }
 
-func usingSortedFolders(logger *zap.Logger, cfg config.Config, imageFiles map[string]image_manager.ImageData) {
-	sortedFolders := file_manager.SortFilesByDate(imageFiles, image_manager.GetTimestamp)
+// explain prints how each of the given files would be classified and where it would be sorted to
+func explain(paths []string) {
+	if len(paths) == 0 {
+		log.Fatal("usage: photo-sorter explain <file>...")
+	}
 
-	logger.Debug("sorted files by date", zap.Any("sortedFolders", sortedFolders))
-	err := file_manager.CreateFolderIfNotExists(logger, cfg.DestinationPath)
+	cfg, err := config.GetExplainConfig()
 	if err != nil {
-		logger.Fatal("failed to create destination path",
-			zap.String("destinationPath", cfg.DestinationPath),
-			zap.Error(err))
+		log.Fatal("failed to get config", zap.Error(err))
 	}
+	logger := logging.NewLogger(cfg.LogLevel)
 
-	for folderName, files := range sortedFolders {
-		err := file_manager.CreateFolderIfNotExists(logger, cfg.DestinationPath+"/"+folderName)
+	for _, path := range paths {
+		err := sorting.ExplainFile(logger, cfg, path, os.Stdout)
 		if err != nil {
-			logger.Fatal("failed to create folder in destination path",
-				zap.String("folderName", folderName),
+			logger.Error("failed to explain file",
+				zap.String("file", path),
 				zap.Error(err))
 		}
-
-		for _, file := range files {
-			err := file_manager.MoveAndRenameFile(
-				logger,
-				file.GetFilePath(),
-				cfg.DestinationPath+"/"+folderName+"/"+file.GetFileName())
-			if err != nil {
-				logger.Fatal("failed to copy and rename file",
-					zap.String("destination", cfg.DestinationPath+"/"+folderName+"/"+file.GetFileName()),
-					zap.String("file", file.GetFileName()),
-					zap.Error(err))
-			}
-		}
 	}
 }
 
-//func nonRecognisedFileSorter(logger *zap.Logger) {
-//	nonRecognisedFiles, err := file_manager.GetFilesSingleFolder(
-//		logger,
-//		testSourcePath,
-//		image_manager.GetImageTypes(),
-//		false,
-//		func(path string) (string, error) { return path, nil },
-//	)
-//
-//	err = file_manager.CreateFolderIfNotExists(logger, testNonImageFilesDestinationPath)
-//	if err != nil {
-//		logger.Fatal("failed to create folder in destination path",
-//			zap.String("folderName", testNonImageFilesDestinationPath),
-//			zap.Error(err))
-//	}
-//
-//	for _, filePath := range nonRecognisedFiles {
-//		if strings.Contains(filePath, "DS_Store") {
-//			continue
-//		}
-//		err := file_manager.MoveAndRenameFile(
-//			logger,
-//			filePath,
-//			testDestinationPath+testNonImageFilesDestinationPath+filePath)
-//		if err != nil {
-//			logger.Fatal("failed to copy and rename file",
-//				zap.String("destination", testDestinationPath+testNonImageFilesDestinationPath+filePath),
-//				zap.String("file", filePath),
-//				zap.Error(err))
-//		}
-//	}
-//}
+// label names the event given by its folder name or date, so files from it are sorted into a folder with the label
+// and the folders already sorted into are renamed
+func label(args []string) {
+	if len(args) != 3 {
+		log.Fatal("usage: photo-sorter label <destination> <event folder name or yyyy-mm-dd[#n]> <label>")
+	}
+
+	store, err := event.ReadStore(args[0])
+	if err != nil {
+		log.Fatal("failed to read events: ", err)
+	}
+	e, oldName, err := store.SetLabel(args[1], args[2])
+	if err != nil {
+		log.Fatal("failed to label event: ", err)
+	}
+	err = store.Write()
+	if err != nil {
+		log.Fatal("failed to write events: ", err)
+	}
+	fmt.Printf("Labelled event %s\n", e.Name())
+
+	if oldName == e.Name() {
+		return
+	}
+	// the files already sorted are moved along with those sorted from now on
+	folders, err := event.RenameFolders(args[0], oldName, e.Name())
+	for _, folder := range folders {
+		fmt.Printf("Renamed folder to %s\n", folder)
+	}
+	if err != nil {
+		log.Fatal("failed to rename event folders: ", err)
+	}
+}
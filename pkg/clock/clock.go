@@ -0,0 +1,79 @@
+package clock
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/barasher/go-exiftool"
+)
+
+const exifTimeFormat = "2006:01:02 15:04:05"
+
+// Offset is a correction applied to timestamps from a camera whose clock was set wrong,
+// From and To are optional and limit the correction to files taken within that range.
+type Offset struct {
+	CameraModel string
+	From        time.Time
+	To          time.Time
+	Offset      time.Duration
+}
+
+func (o Offset) appliesTo(cameraModel string, t time.Time) bool {
+	if !strings.Contains(strings.ToLower(cameraModel), strings.ToLower(o.CameraModel)) {
+		return false
+	}
+	if !o.From.IsZero() && t.Before(o.From) {
+		return false
+	}
+	if !o.To.IsZero() && !t.Before(o.To) {
+		return false
+	}
+	return true
+}
+
+// Correct applies the first offset matching the camera model and timestamp,
+// returning the original timestamp and false if none match.
+func Correct(offsets []Offset, cameraModel string, t time.Time) (time.Time, bool) {
+	if t.IsZero() {
+		return t, false
+	}
+	for _, o := range offsets {
+		if o.appliesTo(cameraModel, t) {
+			return t.Add(o.Offset), true
+		}
+	}
+	return t, false
+}
+
+// MetadataWriter writes corrected timestamps back into a file's metadata using exiftool
+type MetadataWriter struct {
+	et *exiftool.Exiftool
+}
+
+func NewMetadataWriter() (*MetadataWriter, error) {
+	et, err := exiftool.NewExiftool()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize exiftool: %w", err)
+	}
+	return &MetadataWriter{et: et}, nil
+}
+
+func (w *MetadataWriter) WriteTimestamp(path string, t time.Time) error {
+	fm := exiftool.EmptyFileMetadata()
+	fm.File = path
+	fm.SetString("AllDates", t.Format(exifTimeFormat))
+	fm.SetString("TrackCreateDate", t.Format(exifTimeFormat))
+	fm.SetString("MediaCreateDate", t.Format(exifTimeFormat))
+
+	fileMetadata := []exiftool.FileMetadata{fm}
+	w.et.WriteMetadata(fileMetadata)
+	if fileMetadata[0].Err != nil {
+		return fmt.Errorf("failed to write timestamp: %w", fileMetadata[0].Err)
+	}
+	return nil
+}
+
+func (w *MetadataWriter) Close() error {
+	return w.et.Close()
+}
@@ -4,6 +4,17 @@ import (
 	"fmt"
 
 	"github.com/caarlos0/env/v11"
+
+	"github.com/photos-sorter/pkg/clock"
+	"github.com/photos-sorter/pkg/duplicate"
+	"github.com/photos-sorter/pkg/event"
+	"github.com/photos-sorter/pkg/filter"
+	"github.com/photos-sorter/pkg/geocode"
+	"github.com/photos-sorter/pkg/pathtemplate"
+	"github.com/photos-sorter/pkg/quality"
+	"github.com/photos-sorter/pkg/rules"
+	"github.com/photos-sorter/pkg/sequence"
+	"github.com/photos-sorter/pkg/walk"
 )
 
 const (
@@ -23,8 +34,9 @@ const (
 	locationBackupRaw    = "backupRaw"
 	locationBackupEdited = "backupEdited"
 
-	typeImages = "images"
-	typeVideos = "videos"
+	typeImages   = "images"
+	typeVideos   = "videos"
+	typeNonMedia = "non-media"
 
 	fileModeMove = "move"
 	fileModeCopy = "copy"
@@ -58,6 +70,7 @@ type envConfig struct {
 	FileMode string `env:"file_mode"`
 	Location string `env:"loc"`
 	LogLevel string `env:"log"`
+	Config   string `env:"config"`
 }
 
 type Config struct {
@@ -68,6 +81,43 @@ type Config struct {
 	SourcePath      string
 	DestinationPath string
 	LogLevel        string
+
+	// Walk being how the source path is walked for files
+	Walk walk.Options
+	// Filter being which of the files found in the source path are sorted
+	Filter filter.Filter
+
+	ClockOffsets       []clock.Offset
+	WriteCorrectedTime bool
+
+	// PathTemplates keyed by file type
+	PathTemplates map[string]pathtemplate.Set
+	// NameTemplates keyed by file type
+	NameTemplates map[string]pathtemplate.Template
+	// Rules keyed by file type
+	Rules map[string]rules.RuleSet
+
+	ExtractMotionPhotoVideo bool
+	Sequences               sequence.Options
+
+	// MetadataExtractors being the metadata backends to try for a file extension, the default
+	// for extensions not given is every backend that supports it
+	MetadataExtractors map[string][]string
+	// MetadataWorkers being how many files are read at once by the native extractors
+	MetadataWorkers int
+	// ExiftoolProcesses being how many exiftool processes are kept running, each reading a batch of files at a time
+	ExiftoolProcesses int
+
+	// Geocoder finds the place for the {country}, {region} and {place} path template tokens
+	Geocoder *geocode.Geocoder
+	// Sites being named places, such as where trail cameras are mounted, for the {site} path template token
+	Sites geocode.Sites
+	// Events being how images and videos are grouped into events for the {event} path template token
+	Events event.Options
+	// Duplicates being how near-duplicate images are found, all but the best copy are sorted into duplicates/
+	Duplicates duplicate.Options
+	// Quality being the sharpness and exposure below which images are rejects
+	Quality quality.Options
 }
 
 func GetConfig() (Config, error) {
@@ -79,29 +129,9 @@ func GetConfig() (Config, error) {
 
 	var cfg Config
 	cfg.LogLevel = envCfg.LogLevel
-	switch envCfg.Location {
-	case locationTest:
-		cfg.DestinationPath = testConfig.DestinationPath
-		cfg.SourcePath = testConfig.SourcePath
-	case locationTestZip:
-		cfg.DestinationPath = testZipConfig.DestinationPath
-		cfg.SourcePath = testZipConfig.SourcePath
-		cfg.IncludeZips = true
-	case locationSeagate:
-		cfg.DestinationPath = seagateConfig.DestinationPath
-		cfg.SourcePath = seagateConfig.SourcePath
-	case locationBackupRaw:
-		cfg.DestinationPath = backUpRawConfig.DestinationPath
-		cfg.SourcePath = backUpRawConfig.SourcePath
-	case locationBackupEdited:
-		cfg.DestinationPath = backUpEditedConfig.DestinationPath
-		cfg.SourcePath = backUpEditedConfig.SourcePath
-	default:
-		return Config{}, fmt.Errorf("unknown location: %s (choices: %s, %s, %s)",
-			envCfg.Location,
-			locationTest,
-			locationTestZip,
-			locationSeagate)
+	cfg, err = withLocation(cfg, envCfg.Location)
+	if err != nil {
+		return Config{}, err
 	}
 
 	switch envCfg.FileType {
@@ -109,11 +139,14 @@ func GetConfig() (Config, error) {
 		cfg.FileType = typeImages
 	case typeVideos:
 		cfg.FileType = typeVideos
+	case typeNonMedia:
+		cfg.FileType = typeNonMedia
 	default:
-		return Config{}, fmt.Errorf("unknown file type: %s (choices: %s, %s)",
+		return Config{}, fmt.Errorf("unknown file type: %s (choices: %s, %s, %s)",
 			envCfg.FileType,
 			typeImages,
-			typeVideos)
+			typeVideos,
+			typeNonMedia)
 	}
 
 	switch envCfg.FileMode {
@@ -128,5 +161,84 @@ func GetConfig() (Config, error) {
 			fileModeCopy)
 	}
 
+	cfg, err = withFileConfig(cfg, envCfg.Config)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// GetExplainConfig gets the config for explaining how a single file would be sorted, which doesn't need a
+// file type or file mode. The location is optional, it gives the destination to read stored events from.
+func GetExplainConfig() (Config, error) {
+	var envCfg envConfig
+	err := env.Parse(&envCfg)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to get env config: %w", err)
+	}
+
+	var cfg Config
+	cfg.LogLevel = envCfg.LogLevel
+	if envCfg.Location != "" {
+		cfg, err = withLocation(cfg, envCfg.Location)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+	return withFileConfig(cfg, envCfg.Config)
+}
+
+// withLocation sets the source and destination paths for the location
+func withLocation(cfg Config, location string) (Config, error) {
+	switch location {
+	case locationTest:
+		cfg.DestinationPath = testConfig.DestinationPath
+		cfg.SourcePath = testConfig.SourcePath
+	case locationTestZip:
+		cfg.DestinationPath = testZipConfig.DestinationPath
+		cfg.SourcePath = testZipConfig.SourcePath
+		cfg.IncludeZips = true
+	case locationSeagate:
+		cfg.DestinationPath = seagateConfig.DestinationPath
+		cfg.SourcePath = seagateConfig.SourcePath
+	case locationBackupRaw:
+		cfg.DestinationPath = backUpRawConfig.DestinationPath
+		cfg.SourcePath = backUpRawConfig.SourcePath
+	case locationBackupEdited:
+		cfg.DestinationPath = backUpEditedConfig.DestinationPath
+		cfg.SourcePath = backUpEditedConfig.SourcePath
+	default:
+		return cfg, fmt.Errorf("unknown location: %s (choices: %s, %s, %s)",
+			location,
+			locationTest,
+			locationTestZip,
+			locationSeagate)
+	}
+
 	return cfg, nil
 }
+
+func (c Config) ImagePathTemplates() pathtemplate.Set {
+	return c.PathTemplates[typeImages]
+}
+
+func (c Config) VideoPathTemplates() pathtemplate.Set {
+	return c.PathTemplates[typeVideos]
+}
+
+func (c Config) ImageNameTemplate() pathtemplate.Template {
+	return c.NameTemplates[typeImages]
+}
+
+func (c Config) VideoNameTemplate() pathtemplate.Template {
+	return c.NameTemplates[typeVideos]
+}
+
+func (c Config) ImageRules() rules.RuleSet {
+	return c.Rules[typeImages]
+}
+
+func (c Config) VideoRules() rules.RuleSet {
+	return c.Rules[typeVideos]
+}
@@ -0,0 +1,762 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/photos-sorter/pkg/clock"
+	"github.com/photos-sorter/pkg/duplicate"
+	"github.com/photos-sorter/pkg/event"
+	"github.com/photos-sorter/pkg/filter"
+	"github.com/photos-sorter/pkg/genutils"
+	"github.com/photos-sorter/pkg/geocode"
+	"github.com/photos-sorter/pkg/metadata"
+	"github.com/photos-sorter/pkg/pathtemplate"
+	"github.com/photos-sorter/pkg/quality"
+	"github.com/photos-sorter/pkg/rules"
+	"github.com/photos-sorter/pkg/sequence"
+	"github.com/photos-sorter/pkg/walk"
+)
+
+const (
+	offsetDateFormat = "2006-01-02"
+
+	defaultBurstInterval   = time.Second
+	defaultMinBurstLength  = 3
+	defaultBracketInterval = 2 * time.Second
+
+	defaultExiftoolProcesses = 2
+
+	defaultEventGap = 4 * time.Hour
+
+	defaultDuplicateMaxDistance = 6
+
+	defaultMinSharpness = 100
+	defaultMaxClipping  = 0.25
+)
+
+var (
+	// defaultPathTemplates being "<type>/<year>/<month>/<day>/<file>" for images, where other images,
+	// screenshots, messaging and downloads are "<type>/<year>/<file>", and "<type>/<year>/<file>" for videos
+	defaultPathTemplates = map[string]pathTemplateConfig{
+		typeImages: {
+			Default: "{class}/{year}/{month}/{day}/{filename}",
+			Classes: map[string]string{
+				"other":       "{class}/{year}/{filename}",
+				"screenshots": "{class}/{year}/{filename}",
+				"messaging":   "{class}/{year}/{filename}",
+				"downloads":   "{class}/{year}/{filename}",
+			},
+		},
+		typeVideos: {
+			Default: "{class}/{year}/{filename}",
+		},
+	}
+
+	// defaultSitePathTemplates being "wildlife/<site>/<year>/<file>" for videos when sites are configured
+	defaultSitePathTemplates = map[string]map[string]string{
+		typeVideos: {"wildlife": "{class}/{site}/{year}/{filename}"},
+	}
+
+	// defaultNameTemplates being images prefixed with "hhmmss_" and videos keeping their original name
+	defaultNameTemplates = map[string]string{
+		typeImages: "{time}_{stem}{ext}",
+		typeVideos: keepOriginalNameTemplate,
+	}
+)
+
+const keepOriginalNameTemplate = "{stem}{ext}"
+
+// defaultEventPathTemplate being "<type>/<year>/<event>/<file>" for both images and videos when events are found
+const defaultEventPathTemplate = "{class}/{year}/{event}/{filename}"
+
+// fileConfig is the optional json config file, given by the "config" env variable,
+// for settings that are too involved to be passed as env variables
+type fileConfig struct {
+	Walk    *walkConfig   `json:"walk"`
+	Filters *filterConfig `json:"filters"`
+
+	ClockOffsets       []clockOffsetConfig `json:"clockOffsets"`
+	WriteCorrectedTime bool                `json:"writeCorrectedTime"`
+
+	PathTemplates map[string]pathTemplateConfig `json:"pathTemplates"`
+	Rename        *renameConfig                 `json:"rename"`
+
+	// RulesFile is the path to a json file of classification rules keyed by file type
+	RulesFile string `json:"rulesFile"`
+
+	// ExtractMotionPhotoVideo writes the video embedded in google motion photos next to the still
+	ExtractMotionPhotoVideo bool `json:"extractMotionPhotoVideo"`
+
+	// Sequences groups bursts and exposure brackets into their own folders when given
+	Sequences *sequenceConfig `json:"sequences"`
+
+	// MetadataExtractors being the metadata backends to try for a file extension, in order
+	MetadataExtractors map[string][]string `json:"metadataExtractors"`
+	MetadataWorkers    int                 `json:"metadataWorkers"`
+	ExiftoolProcesses  int                 `json:"exiftoolProcesses"`
+
+	Geocoding *geocodingConfig `json:"geocoding"`
+	Sites     []siteConfig     `json:"sites"`
+	Events    *eventConfig     `json:"events"`
+
+	// Duplicates finds copies of the same image at different sizes or compressions when given
+	Duplicates *duplicateConfig `json:"duplicates"`
+
+	// Quality scores each image's sharpness and exposure to find rejects when given
+	Quality *qualityConfig `json:"quality"`
+}
+
+// qualityConfig being when an image is a reject, minSharpness is the lowest variance of its laplacian and
+// maxClipping the highest fraction of pure black or white pixels, either can be 0 to not check it
+type qualityConfig struct {
+	MinSharpness *float64 `json:"minSharpness"`
+	MaxClipping  *float64 `json:"maxClipping"`
+	MoveRejects  bool     `json:"moveRejects"`
+}
+
+// duplicateConfig being how near-duplicates are found, algorithm is either "dhash" or "phash" and
+// maxDistance is the most bits their perceptual hashes can differ by
+type duplicateConfig struct {
+	Algorithm   string `json:"algorithm"`
+	MaxDistance *int   `json:"maxDistance"`
+}
+
+// walkConfig being how the source path is walked, hidden and system folders are skipped unless set to false,
+// maxDepth being how many levels of folders are walked with 1 being only the source path
+type walkConfig struct {
+	FollowSymlinks bool  `json:"followSymlinks"`
+	SkipHidden     *bool `json:"skipHidden"`
+	SkipSystem     *bool `json:"skipSystem"`
+	MaxDepth       int   `json:"maxDepth"`
+	StopOnError    bool  `json:"stopOnError"`
+}
+
+// filterConfig being which files are sorted, from and to are dates in the format "yyyy-mm-dd" and are
+// both inclusive, sizes are such as "500KB" or "2GB", and paths are globs relative to the source path
+type filterConfig struct {
+	From         string         `json:"from"`
+	To           string         `json:"to"`
+	CameraModels includeConfig  `json:"cameraModels"`
+	Extensions   includeConfig  `json:"extensions"`
+	MinSize      string         `json:"minSize"`
+	MaxSize      string         `json:"maxSize"`
+	Paths        *includeConfig `json:"paths"`
+}
+
+type includeConfig struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// eventConfig being how files are grouped into events, gap is a duration such as "4h" and is the
+// longest time between files in the same event, maxDistanceKm optionally starts a new event on moving
+type eventConfig struct {
+	Gap           string  `json:"gap"`
+	MaxDistanceKm float64 `json:"maxDistanceKm"`
+}
+
+// siteConfig being a named place found by one or more of a polygon of [latitude, longitude] points,
+// a centre point with a radius in metres, or the serial numbers of the cameras kept there
+type siteConfig struct {
+	Name          string       `json:"name"`
+	Polygon       [][2]float64 `json:"polygon"`
+	Center        *[2]float64  `json:"center"`
+	RadiusMeters  float64      `json:"radiusMeters"`
+	CameraSerials []string     `json:"cameraSerials"`
+}
+
+// geocodingConfig being how places are found from gps coordinates, dataset is an optional csv or GeoNames
+// file of places to use instead of the bundled one, maxDistanceKm how far a file can be from the nearest
+// place and countryDistanceKm how far it can be for just the place's country
+type geocodingConfig struct {
+	Dataset           string  `json:"dataset"`
+	MaxDistanceKm     float64 `json:"maxDistanceKm"`
+	CountryDistanceKm float64 `json:"countryDistanceKm"`
+}
+
+// sequenceConfig being how bursts and bracketed exposures are found, the intervals are
+// durations such as "500ms" and are the longest gap between consecutive shots
+type sequenceConfig struct {
+	BurstInterval   string `json:"burstInterval"`
+	MinBurstLength  int    `json:"minBurstLength"`
+	BracketInterval string `json:"bracketInterval"`
+}
+
+// renameConfig being how both images and videos are renamed, either a name template
+// such as "{date}_{time}_{seq}{ext}" or keeping the original file name
+type renameConfig struct {
+	Template         string `json:"template"`
+	KeepOriginalName bool   `json:"keepOriginalName"`
+}
+
+// pathTemplateConfig being the destination path template for a file type,
+// with optional templates for specific classes such as "raw" or "other"
+type pathTemplateConfig struct {
+	Default string            `json:"default"`
+	Classes map[string]string `json:"classes"`
+}
+
+// clockOffsetConfig being a camera model with an offset such as "+1h" or "-2m30s",
+// from and to are optional dates in the format "yyyy-mm-dd" and are both inclusive
+type clockOffsetConfig struct {
+	CameraModel string `json:"cameraModel"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Offset      string `json:"offset"`
+}
+
+// withFileConfig adds the settings from the config file, or their defaults, to the config
+func withFileConfig(cfg Config, path string) (Config, error) {
+	fileCfg, err := readFileConfig(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to get file config: %w", err)
+	}
+
+	cfg.Walk, err = toWalkOptions(fileCfg.Walk)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid walk: %w", err)
+	}
+
+	cfg.Filter, err = toFilter(fileCfg.Filters)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid filters: %w", err)
+	}
+
+	cfg.ClockOffsets, err = toClockOffsets(fileCfg.ClockOffsets)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid clock offsets: %w", err)
+	}
+	cfg.WriteCorrectedTime = fileCfg.WriteCorrectedTime
+
+	cfg.Sites, err = toSites(fileCfg.Sites)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid sites: %w", err)
+	}
+
+	cfg.Events, err = toEventOptions(fileCfg.Events)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid events: %w", err)
+	}
+
+	cfg.PathTemplates, err = toPathTemplates(fileCfg.PathTemplates, len(cfg.Sites) > 0, cfg.Events.Enabled())
+	if err != nil {
+		return cfg, fmt.Errorf("invalid path templates: %w", err)
+	}
+
+	cfg.NameTemplates, err = toNameTemplates(fileCfg.Rename)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid rename: %w", err)
+	}
+
+	cfg.Rules, err = toRuleSets(fileCfg.RulesFile)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid rules: %w", err)
+	}
+
+	cfg.ExtractMotionPhotoVideo = fileCfg.ExtractMotionPhotoVideo
+
+	cfg.Sequences, err = toSequenceOptions(fileCfg.Sequences)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid sequences: %w", err)
+	}
+
+	cfg.MetadataExtractors, err = toMetadataExtractors(fileCfg.MetadataExtractors)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid metadata extractors: %w", err)
+	}
+
+	cfg.MetadataWorkers = fileCfg.MetadataWorkers
+	if cfg.MetadataWorkers <= 0 {
+		cfg.MetadataWorkers = runtime.NumCPU()
+	}
+	cfg.ExiftoolProcesses = fileCfg.ExiftoolProcesses
+	if cfg.ExiftoolProcesses <= 0 {
+		cfg.ExiftoolProcesses = defaultExiftoolProcesses
+	}
+
+	cfg.Geocoder, err = toGeocoder(fileCfg.Geocoding)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid geocoding: %w", err)
+	}
+
+	cfg.Duplicates, err = toDuplicateOptions(fileCfg.Duplicates)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid duplicates: %w", err)
+	}
+
+	cfg.Quality, err = toQualityOptions(fileCfg.Quality)
+	if err != nil {
+		return cfg, fmt.Errorf("invalid quality: %w", err)
+	}
+
+	return cfg, nil
+}
+
+func readFileConfig(path string) (fileConfig, error) {
+	var fileCfg fileConfig
+	if path == "" {
+		return fileCfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileCfg, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	err = json.Unmarshal(data, &fileCfg)
+	if err != nil {
+		return fileCfg, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return fileCfg, nil
+}
+
+func toClockOffsets(offsetCfgs []clockOffsetConfig) ([]clock.Offset, error) {
+	offsets := make([]clock.Offset, 0, len(offsetCfgs))
+	for i, o := range offsetCfgs {
+		if o.CameraModel == "" {
+			return nil, fmt.Errorf("clock offset %d has no camera model", i)
+		}
+
+		offset, err := time.ParseDuration(o.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("clock offset %d has an invalid offset: %w", i, err)
+		}
+
+		var from, to time.Time
+		if o.From != "" {
+			from, err = time.Parse(offsetDateFormat, o.From)
+			if err != nil {
+				return nil, fmt.Errorf("clock offset %d has an invalid from date: %w", i, err)
+			}
+		}
+		if o.To != "" {
+			to, err = time.Parse(offsetDateFormat, o.To)
+			if err != nil {
+				return nil, fmt.Errorf("clock offset %d has an invalid to date: %w", i, err)
+			}
+			// to is inclusive of the whole day
+			to = to.AddDate(0, 0, 1)
+		}
+		if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+			return nil, fmt.Errorf("clock offset %d has a from date after its to date", i)
+		}
+
+		offsets = append(offsets, clock.Offset{
+			CameraModel: o.CameraModel,
+			From:        from,
+			To:          to,
+			Offset:      offset,
+		})
+	}
+	return offsets, nil
+}
+
+// toPathTemplates adds the user's templates over the defaults, with sites configured wildlife
+// videos are sorted by site by default and with events found files are sorted by event
+func toPathTemplates(templateCfgs map[string]pathTemplateConfig, hasSites, hasEvents bool,
+) (map[string]pathtemplate.Set, error) {
+	for fileType := range templateCfgs {
+		if _, ok := defaultPathTemplates[fileType]; !ok {
+			return nil, fmt.Errorf("path templates given for unknown file type: %s (choices: %s, %s)",
+				fileType, typeImages, typeVideos)
+		}
+	}
+
+	templates := make(map[string]pathtemplate.Set)
+	for fileType, defaultCfg := range defaultPathTemplates {
+		templateCfg := pathTemplateConfig{
+			Default: defaultCfg.Default,
+			Classes: make(map[string]string),
+		}
+		if hasEvents {
+			templateCfg.Default = defaultEventPathTemplate
+		}
+		for class, t := range defaultCfg.Classes {
+			templateCfg.Classes[class] = t
+		}
+		if hasSites {
+			for class, t := range defaultSitePathTemplates[fileType] {
+				templateCfg.Classes[class] = t
+			}
+		}
+		if userCfg, ok := templateCfgs[fileType]; ok {
+			if userCfg.Default != "" {
+				templateCfg.Default = userCfg.Default
+			}
+			for class, t := range userCfg.Classes {
+				templateCfg.Classes[class] = t
+			}
+		}
+
+		set := pathtemplate.Set{Classes: make(map[string]pathtemplate.Template)}
+		var err error
+		set.Default, err = pathtemplate.Parse(templateCfg.Default)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s path template: %w", fileType, err)
+		}
+		for class, t := range templateCfg.Classes {
+			set.Classes[class], err = pathtemplate.Parse(t)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s path template for %s: %w", fileType, class, err)
+			}
+		}
+		templates[fileType] = set
+	}
+	return templates, nil
+}
+
+func toNameTemplates(renameCfg *renameConfig) (map[string]pathtemplate.Template, error) {
+	nameTemplates := make(map[string]string)
+	for fileType, t := range defaultNameTemplates {
+		switch {
+		case renameCfg == nil:
+			nameTemplates[fileType] = t
+		case renameCfg.KeepOriginalName:
+			nameTemplates[fileType] = keepOriginalNameTemplate
+		case renameCfg.Template != "":
+			nameTemplates[fileType] = renameCfg.Template
+		default:
+			return nil, fmt.Errorf("rename needs either a template or keepOriginalName")
+		}
+	}
+
+	templates := make(map[string]pathtemplate.Template)
+	for fileType, t := range nameTemplates {
+		var err error
+		templates[fileType], err = pathtemplate.ParseName(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s name template: %w", fileType, err)
+		}
+	}
+	return templates, nil
+}
+
+func toRuleSets(rulesFile string) (map[string]rules.RuleSet, error) {
+	ruleSets := map[string]rules.RuleSet{
+		typeImages: rules.DefaultImageRules,
+		typeVideos: rules.DefaultVideoRules,
+	}
+	if rulesFile != "" {
+		fileRuleSets, err := rules.ReadFile(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		for fileType, ruleSet := range fileRuleSets {
+			if _, ok := ruleSets[fileType]; !ok {
+				return nil, fmt.Errorf("rules given for unknown file type: %s (choices: %s, %s)",
+					fileType, typeImages, typeVideos)
+			}
+			ruleSets[fileType] = ruleSet
+		}
+	}
+
+	for fileType, ruleSet := range ruleSets {
+		var err error
+		ruleSets[fileType], err = ruleSet.Compile()
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s rules: %w", fileType, err)
+		}
+	}
+	return ruleSets, nil
+}
+
+func toSequenceOptions(sequenceCfg *sequenceConfig) (sequence.Options, error) {
+	if sequenceCfg == nil {
+		return sequence.Options{}, nil
+	}
+
+	opts := sequence.Options{
+		BurstInterval:   defaultBurstInterval,
+		MinBurstLength:  defaultMinBurstLength,
+		BracketInterval: defaultBracketInterval,
+	}
+	var err error
+	if sequenceCfg.BurstInterval != "" {
+		opts.BurstInterval, err = time.ParseDuration(sequenceCfg.BurstInterval)
+		if err != nil || opts.BurstInterval <= 0 {
+			return opts, fmt.Errorf("burst interval must be a positive duration: %s", sequenceCfg.BurstInterval)
+		}
+	}
+	if sequenceCfg.BracketInterval != "" {
+		opts.BracketInterval, err = time.ParseDuration(sequenceCfg.BracketInterval)
+		if err != nil || opts.BracketInterval <= 0 {
+			return opts, fmt.Errorf("bracket interval must be a positive duration: %s", sequenceCfg.BracketInterval)
+		}
+	}
+	if sequenceCfg.MinBurstLength != 0 {
+		if sequenceCfg.MinBurstLength < 2 {
+			return opts, fmt.Errorf("min burst length must be at least 2: %d", sequenceCfg.MinBurstLength)
+		}
+		opts.MinBurstLength = sequenceCfg.MinBurstLength
+	}
+	return opts, nil
+}
+
+func toMetadataExtractors(extractorCfgs map[string][]string) (map[string][]string, error) {
+	extractors := make(map[string][]string)
+	for ext, names := range extractorCfgs {
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no metadata extractors given for %s", ext)
+		}
+		for _, name := range names {
+			if !genutils.InArray(metadata.ExtractorNames, name) {
+				return nil, fmt.Errorf("unknown metadata extractor for %s: %s (choices: %s)",
+					ext, name, strings.Join(metadata.ExtractorNames, ", "))
+			}
+		}
+		extractors[strings.ToLower(strings.TrimPrefix(ext, "."))] = names
+	}
+	return extractors, nil
+}
+
+func toGeocoder(geocodingCfg *geocodingConfig) (*geocode.Geocoder, error) {
+	if geocodingCfg == nil {
+		return geocode.New("", geocode.DefaultMaxDistanceKm, geocode.DefaultCountryDistanceKm)
+	}
+	if geocodingCfg.MaxDistanceKm < 0 || geocodingCfg.CountryDistanceKm < 0 {
+		return nil, fmt.Errorf("max distance must not be negative")
+	}
+	return geocode.New(geocodingCfg.Dataset, geocodingCfg.MaxDistanceKm, geocodingCfg.CountryDistanceKm)
+}
+
+func toSites(siteCfgs []siteConfig) (geocode.Sites, error) {
+	sites := make(geocode.Sites, 0, len(siteCfgs))
+	var names []string
+	for i, siteCfg := range siteCfgs {
+		if siteCfg.Name == "" {
+			return nil, fmt.Errorf("site %d has no name", i)
+		}
+		if strings.ContainsAny(siteCfg.Name, `/\`) || siteCfg.Name == "." || siteCfg.Name == ".." {
+			return nil, fmt.Errorf("site name %q must be a single folder", siteCfg.Name)
+		}
+		if genutils.InArray(names, siteCfg.Name) {
+			return nil, fmt.Errorf("site %q is given more than once", siteCfg.Name)
+		}
+		names = append(names, siteCfg.Name)
+
+		site := geocode.Site{Name: siteCfg.Name, CameraSerials: siteCfg.CameraSerials}
+		if len(siteCfg.Polygon) > 0 {
+			if len(siteCfg.Polygon) < 3 {
+				return nil, fmt.Errorf("site %q polygon needs at least 3 points", siteCfg.Name)
+			}
+			for _, point := range siteCfg.Polygon {
+				site.Polygon = append(site.Polygon, metadata.Location{Latitude: point[0], Longitude: point[1]})
+			}
+		}
+		if siteCfg.Center != nil {
+			if siteCfg.RadiusMeters <= 0 {
+				return nil, fmt.Errorf("site %q has a centre but no radius", siteCfg.Name)
+			}
+			site.Center = &metadata.Location{Latitude: siteCfg.Center[0], Longitude: siteCfg.Center[1]}
+			site.RadiusMeters = siteCfg.RadiusMeters
+		}
+		if len(site.Polygon) == 0 && site.Center == nil && len(site.CameraSerials) == 0 {
+			return nil, fmt.Errorf("site %q needs a polygon, a centre and radius, or camera serials", siteCfg.Name)
+		}
+		sites = append(sites, site)
+	}
+	return sites, nil
+}
+
+func toEventOptions(eventCfg *eventConfig) (event.Options, error) {
+	if eventCfg == nil {
+		return event.Options{}, nil
+	}
+
+	opts := event.Options{Gap: defaultEventGap, MaxDistanceKm: eventCfg.MaxDistanceKm}
+	if eventCfg.Gap != "" {
+		var err error
+		opts.Gap, err = time.ParseDuration(eventCfg.Gap)
+		if err != nil || opts.Gap <= 0 {
+			return opts, fmt.Errorf("gap must be a positive duration: %s", eventCfg.Gap)
+		}
+	}
+	if opts.MaxDistanceKm < 0 {
+		return opts, fmt.Errorf("max distance must not be negative")
+	}
+	return opts, nil
+}
+
+func toDuplicateOptions(duplicateCfg *duplicateConfig) (duplicate.Options, error) {
+	if duplicateCfg == nil {
+		return duplicate.Options{}, nil
+	}
+
+	opts := duplicate.Options{Algorithm: duplicate.DHash, MaxDistance: defaultDuplicateMaxDistance}
+	if duplicateCfg.Algorithm != "" {
+		if !genutils.InArray(duplicate.Algorithms, duplicateCfg.Algorithm) {
+			return opts, fmt.Errorf("unknown algorithm: %s (choices: %s)",
+				duplicateCfg.Algorithm, strings.Join(duplicate.Algorithms, ", "))
+		}
+		opts.Algorithm = duplicateCfg.Algorithm
+	}
+	if duplicateCfg.MaxDistance != nil {
+		if *duplicateCfg.MaxDistance < 0 || *duplicateCfg.MaxDistance > 64 {
+			return opts, fmt.Errorf("max distance must be between 0 and 64: %d", *duplicateCfg.MaxDistance)
+		}
+		opts.MaxDistance = *duplicateCfg.MaxDistance
+	}
+	return opts, nil
+}
+
+func toQualityOptions(qualityCfg *qualityConfig) (quality.Options, error) {
+	if qualityCfg == nil {
+		return quality.Options{}, nil
+	}
+
+	opts := quality.Options{
+		MinSharpness: defaultMinSharpness,
+		MaxClipping:  defaultMaxClipping,
+		MoveRejects:  qualityCfg.MoveRejects,
+	}
+	if qualityCfg.MinSharpness != nil {
+		if *qualityCfg.MinSharpness < 0 {
+			return opts, fmt.Errorf("min sharpness must not be negative")
+		}
+		opts.MinSharpness = *qualityCfg.MinSharpness
+	}
+	if qualityCfg.MaxClipping != nil {
+		if *qualityCfg.MaxClipping < 0 || *qualityCfg.MaxClipping > 1 {
+			return opts, fmt.Errorf("max clipping must be between 0 and 1: %g", *qualityCfg.MaxClipping)
+		}
+		opts.MaxClipping = *qualityCfg.MaxClipping
+	}
+	return opts, nil
+}
+
+func toWalkOptions(walkCfg *walkConfig) (walk.Options, error) {
+	opts := walk.Options{SkipHidden: true, SkipSystem: true}
+	if walkCfg == nil {
+		return opts, nil
+	}
+
+	if walkCfg.MaxDepth < 0 {
+		return opts, fmt.Errorf("max depth must not be negative: %d", walkCfg.MaxDepth)
+	}
+	opts.FollowSymlinks = walkCfg.FollowSymlinks
+	opts.MaxDepth = walkCfg.MaxDepth
+	opts.StopOnError = walkCfg.StopOnError
+	if walkCfg.SkipHidden != nil {
+		opts.SkipHidden = *walkCfg.SkipHidden
+	}
+	if walkCfg.SkipSystem != nil {
+		opts.SkipSystem = *walkCfg.SkipSystem
+	}
+	return opts, nil
+}
+
+func toFilter(filterCfg *filterConfig) (filter.Filter, error) {
+	f := filter.Filter{ExcludePaths: filter.DefaultExcludePaths}
+	if filterCfg == nil {
+		return f, nil
+	}
+
+	var err error
+	if filterCfg.From != "" {
+		f.From, err = time.Parse(offsetDateFormat, filterCfg.From)
+		if err != nil {
+			return f, fmt.Errorf("invalid from date: %w", err)
+		}
+	}
+	if filterCfg.To != "" {
+		f.To, err = time.Parse(offsetDateFormat, filterCfg.To)
+		if err != nil {
+			return f, fmt.Errorf("invalid to date: %w", err)
+		}
+		// to is inclusive of the whole day
+		f.To = f.To.AddDate(0, 0, 1)
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return f, fmt.Errorf("from date is after the to date")
+	}
+
+	f.IncludeCameraModels, err = compileCameraModels(filterCfg.CameraModels.Include)
+	if err != nil {
+		return f, err
+	}
+	f.ExcludeCameraModels, err = compileCameraModels(filterCfg.CameraModels.Exclude)
+	if err != nil {
+		return f, err
+	}
+	for _, ext := range filterCfg.Extensions.Include {
+		f.IncludeExtensions = append(f.IncludeExtensions, strings.ToLower(strings.TrimPrefix(ext, ".")))
+	}
+	for _, ext := range filterCfg.Extensions.Exclude {
+		f.ExcludeExtensions = append(f.ExcludeExtensions, strings.ToLower(strings.TrimPrefix(ext, ".")))
+	}
+
+	f.MinSize, err = parseSize(filterCfg.MinSize)
+	if err != nil {
+		return f, fmt.Errorf("invalid min size: %w", err)
+	}
+	f.MaxSize, err = parseSize(filterCfg.MaxSize)
+	if err != nil {
+		return f, fmt.Errorf("invalid max size: %w", err)
+	}
+	if f.MinSize > 0 && f.MaxSize > 0 && f.MinSize > f.MaxSize {
+		return f, fmt.Errorf("min size is more than the max size")
+	}
+
+	if filterCfg.Paths != nil {
+		f.IncludePaths = filterCfg.Paths.Include
+		if filterCfg.Paths.Exclude != nil {
+			f.ExcludePaths = filterCfg.Paths.Exclude
+		}
+		for _, glob := range append(append([]string{}, f.IncludePaths...), f.ExcludePaths...) {
+			if _, err := path.Match(glob, ""); err != nil {
+				return f, fmt.Errorf("invalid path glob %q: %w", glob, err)
+			}
+		}
+	}
+	return f, nil
+}
+
+// compileCameraModels compiles the camera models as case-insensitive regular expressions, as in the rules
+func compileCameraModels(models []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(models))
+	for _, model := range models {
+		re, err := regexp.Compile("(?i)" + model)
+		if err != nil {
+			return nil, fmt.Errorf("invalid camera model %q: %w", model, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// parseSize parses a file size such as "500KB" or "2GB" into bytes, where a KB is 1024 bytes
+func parseSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	s := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("size must be a number of bytes, KB, MB or GB: %s", size)
+	}
+	return int64(n * float64(multiplier)), nil
+}
@@ -0,0 +1,193 @@
+package duplicate
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+)
+
+const (
+	DHash = "dhash"
+	PHash = "phash"
+)
+
+// Algorithms being the perceptual hashes that can be chosen in the config
+var Algorithms = []string{DHash, PHash}
+
+// Options being how near-duplicates are found, the zero value finds none.
+// MaxDistance is the most bits two perceptual hashes can differ by and still be the same photo.
+type Options struct {
+	Algorithm   string
+	MaxDistance int
+}
+
+func (o Options) Enabled() bool {
+	return o.Algorithm != ""
+}
+
+// Item being a single image with its perceptual hash, Width and Height are the size of the decoded image
+// and HasCamera whether it still has its camera metadata, which messaging apps strip
+type Item struct {
+	ID        string
+	Hash      uint64
+	Time      time.Time
+	Width     int
+	Height    int
+	Size      int64
+	HasCamera bool
+}
+
+func (i Item) Pixels() int {
+	return i.Width * i.Height
+}
+
+// Group being copies of the same photo, Keep being the highest quality copy
+type Group struct {
+	Keep       Item
+	Duplicates []Item
+	// MaxDistance is the furthest apart any copy's hash is from the kept copy's
+	MaxDistance int
+}
+
+// Summary describes the group, such as "3 copies within 2 bits, kept the copy with 12192768 pixels"
+func (g Group) Summary() string {
+	return fmt.Sprintf("%d copies within %d bits, kept the copy with %d pixels",
+		len(g.Duplicates)+1, g.MaxDistance, g.Keep.Pixels())
+}
+
+// Find groups the items whose hashes are within the max distance of each other, keeping the copy with
+// the most pixels, then the biggest file, then the one with camera metadata
+func Find(items []Item, opts Options) []Group {
+	if !opts.Enabled() {
+		return nil
+	}
+
+	sorted := append([]Item{}, items...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	parents := make([]int, len(sorted))
+	for i := range parents {
+		parents[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+		return parents[i]
+	}
+	candidatePairs(sorted, opts.MaxDistance, func(i, j int) {
+		if samePhoto(sorted[i], sorted[j], opts.MaxDistance) {
+			parents[find(j)] = find(i)
+		}
+	})
+
+	clusters := make(map[int][]Item)
+	var roots []int
+	for i, item := range sorted {
+		root := find(i)
+		if _, ok := clusters[root]; !ok {
+			roots = append(roots, root)
+		}
+		clusters[root] = append(clusters[root], item)
+	}
+
+	var groups []Group
+	for _, root := range roots {
+		cluster := clusters[root]
+		if len(cluster) < 2 {
+			continue
+		}
+		sort.SliceStable(cluster, func(i, j int) bool { return betterCopy(cluster[i], cluster[j]) })
+
+		g := Group{Keep: cluster[0], Duplicates: cluster[1:]}
+		for _, d := range g.Duplicates {
+			g.MaxDistance = max(g.MaxDistance, bits.OnesCount64(g.Keep.Hash^d.Hash))
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// candidatePairs calls fn with each pair of items whose hashes could be within maxDistance bits. Split into
+// maxDistance+1 parts, hashes that close have at least one part the same, so items are only compared with
+// those sharing a part rather than with every other item. Pairs sharing several parts are given more than once
+func candidatePairs(items []Item, maxDistance int, fn func(i, j int)) {
+	parts := maxDistance + 1
+	if parts > 64 {
+		for i := range items {
+			for j := i + 1; j < len(items); j++ {
+				fn(i, j)
+			}
+		}
+		return
+	}
+
+	for p := 0; p < parts; p++ {
+		from, to := p*64/parts, (p+1)*64/parts
+		buckets := make(map[uint64][]int)
+		var keys []uint64
+		for i, item := range items {
+			key := item.Hash << from >> (64 - (to - from))
+			if _, ok := buckets[key]; !ok {
+				keys = append(keys, key)
+			}
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, key := range keys {
+			bucket := buckets[key]
+			for a, i := range bucket {
+				for _, j := range bucket[a+1:] {
+					fn(i, j)
+				}
+			}
+		}
+	}
+}
+
+// samePhoto is whether two items within the max distance are copies of the same photo. A copy that has lost
+// its capture time could be of any photo, so it only matches when the hashes are within half the max distance
+// or the images are the same shape, rather than any similar looking photo of the same scene
+func samePhoto(a, b Item, maxDistance int) bool {
+	distance := bits.OnesCount64(a.Hash ^ b.Hash)
+	if distance > maxDistance {
+		return false
+	}
+	if a.Time.IsZero() || b.Time.IsZero() {
+		return distance <= maxDistance/2 || sameShape(a, b)
+	}
+	return sameMoment(a.Time, b.Time)
+}
+
+// sameShape is whether the images have the same aspect ratio to within 1%, either way up
+func sameShape(a, b Item) bool {
+	if a.Pixels() == 0 || b.Pixels() == 0 {
+		return false
+	}
+	ratio := func(i Item) float64 {
+		return float64(max(i.Width, i.Height)) / float64(min(i.Width, i.Height))
+	}
+	return math.Abs(ratio(a)-ratio(b)) <= ratio(a)*0.01
+}
+
+func betterCopy(a, b Item) bool {
+	if a.Pixels() != b.Pixels() {
+		return a.Pixels() > b.Pixels()
+	}
+	if a.Size != b.Size {
+		return a.Size > b.Size
+	}
+	return a.HasCamera && !b.HasCamera
+}
+
+// sameMoment is whether two copies could be the same photo by when they were taken, burst shots taken
+// moments apart are kept as separate photos.
+// Some copies keep the time without its fraction of a second, so these match to the second.
+func sameMoment(a, b time.Time) bool {
+	if a.Equal(b) {
+		return true
+	}
+	return (a.Nanosecond() == 0 || b.Nanosecond() == 0) && a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
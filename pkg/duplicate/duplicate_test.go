@@ -0,0 +1,133 @@
+package duplicate
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFind(t *testing.T) {
+	taken := time.Date(2021, 6, 5, 14, 30, 15, 250_000_000, time.UTC)
+	opts := Options{Algorithm: DHash, MaxDistance: 6}
+	const hash = 0xf0f0_3c3c_a5a5_0ff0
+
+	tests := []struct {
+		name  string
+		items []Item
+		opts  Options
+		// want being the kept item then its duplicates for each group
+		want [][]string
+	}{
+		{
+			name: "smaller copy within the max distance",
+			items: []Item{
+				{ID: "small", Hash: hash ^ 0b111, Time: taken, Width: 1600, Height: 1200},
+				{ID: "original", Hash: hash, Time: taken, Width: 4000, Height: 3000},
+			},
+			opts: opts,
+			want: [][]string{{"original", "small"}},
+		},
+		{
+			name: "too far apart",
+			items: []Item{
+				{ID: "a", Hash: hash, Time: taken, Width: 4000, Height: 3000},
+				{ID: "b", Hash: hash ^ 0b1111111, Time: taken, Width: 1600, Height: 1200},
+			},
+			opts: opts,
+		},
+		{
+			name: "differing bits spread over every part",
+			items: []Item{
+				{ID: "a", Hash: hash, Time: taken, Width: 4000, Height: 3000},
+				{ID: "b", Hash: hash ^ (1 | 1<<10 | 1<<19 | 1<<28 | 1<<37 | 1<<46), Time: taken, Width: 1600, Height: 1200},
+			},
+			opts: opts,
+			want: [][]string{{"a", "b"}},
+		},
+		{
+			name: "burst shots a moment apart",
+			items: []Item{
+				{ID: "a", Hash: hash, Time: taken, Width: 4000, Height: 3000},
+				{ID: "b", Hash: hash, Time: taken.Add(100 * time.Millisecond), Width: 4000, Height: 3000},
+			},
+			opts: opts,
+		},
+		{
+			name: "copy that lost the fraction of a second",
+			items: []Item{
+				{ID: "a", Hash: hash, Time: taken, Width: 4000, Height: 3000},
+				{ID: "b", Hash: hash ^ 1, Time: taken.Truncate(time.Second), Width: 1600, Height: 1200},
+			},
+			opts: opts,
+			want: [][]string{{"a", "b"}},
+		},
+		{
+			name: "timeless copy of the same shape",
+			items: []Item{
+				{ID: "a", Hash: hash, Time: taken, Width: 4000, Height: 3000},
+				{ID: "whatsapp", Hash: hash ^ 0b111111, Width: 1200, Height: 1600},
+			},
+			opts: opts,
+			want: [][]string{{"a", "whatsapp"}},
+		},
+		{
+			name: "timeless copy close to the hash",
+			items: []Item{
+				{ID: "a", Hash: hash, Time: taken, Width: 4000, Height: 3000},
+				{ID: "crop", Hash: hash ^ 0b111, Width: 1080, Height: 1080},
+			},
+			opts: opts,
+			want: [][]string{{"a", "crop"}},
+		},
+		{
+			name: "timeless image of another shape further away",
+			items: []Item{
+				{ID: "a", Hash: hash, Time: taken, Width: 4000, Height: 3000},
+				{ID: "crop", Hash: hash ^ 0b1111, Width: 1080, Height: 1080},
+			},
+			opts: opts,
+		},
+		{
+			name: "copies chained through each other",
+			items: []Item{
+				{ID: "a", Hash: hash, Time: taken, Width: 4000, Height: 3000, Size: 100},
+				{ID: "b", Hash: hash ^ 0b111, Time: taken, Width: 4000, Height: 3000, Size: 200},
+				{ID: "c", Hash: hash ^ 0b111111, Time: taken, Width: 4000, Height: 3000, Size: 50, HasCamera: true},
+			},
+			opts: opts,
+			want: [][]string{{"b", "a", "c"}},
+		},
+		{
+			name: "any distance",
+			items: []Item{
+				{ID: "a", Hash: 0, Time: taken, Width: 10, Height: 10},
+				{ID: "b", Hash: ^uint64(0), Time: taken, Width: 10, Height: 10, HasCamera: true},
+			},
+			opts: Options{Algorithm: PHash, MaxDistance: 64},
+			want: [][]string{{"b", "a"}},
+		},
+		{
+			name: "disabled",
+			items: []Item{
+				{ID: "a", Hash: hash, Time: taken},
+				{ID: "b", Hash: hash, Time: taken},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			for _, g := range Find(tt.items, tt.opts) {
+				ids := []string{g.Keep.ID}
+				for _, d := range g.Duplicates {
+					ids = append(ids, d.ID)
+				}
+				got = append(got, ids)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
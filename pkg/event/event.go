@@ -0,0 +1,345 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/photos-sorter/pkg/geocode"
+	"github.com/photos-sorter/pkg/metadata"
+)
+
+const (
+	// FileName being the file in the destination path the events are kept in between runs
+	FileName = "photo-sorter-events.json"
+
+	dateFormat = "2006-01-02"
+)
+
+// Options being how files are clustered into events, the zero value finds none.
+// A new event starts after a gap of more than Gap between files, or when MaxDistanceKm
+// is set, when consecutive files with gps coordinates are further apart than that.
+type Options struct {
+	Gap           time.Duration
+	MaxDistanceKm float64
+}
+
+func (o Options) Enabled() bool {
+	return o.Gap > 0
+}
+
+// Item being a single image or video
+type Item struct {
+	ID       string
+	Time     time.Time
+	Location *metadata.Location
+}
+
+// Event being the items taken close together, along with its label from the events file
+type Event struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Label string    `json:"label,omitempty"`
+	// Key being the event's date range when it was first stored, such as "2024-05-01_2024-05-03", which its
+	// folder keeps when a later run extends the event
+	Key string `json:"key,omitempty"`
+	// Location being where the event's first file with gps coordinates was taken, so a later event within the
+	// gap but further away than the max distance isn't merged into it
+	Location *metadata.Location `json:"location,omitempty"`
+
+	IDs []string `json:"-"`
+}
+
+// Name is the event's folder name, its key followed by its label
+func (e Event) Name() string {
+	name := e.Key
+	if name == "" {
+		name = dateRange(e.Start, e.End)
+	}
+	if e.Label != "" {
+		name += " " + e.Label
+	}
+	return name
+}
+
+// dateRange being such as "2024-05-01", or "2024-05-01_2024-05-03" for an event over more than one day
+func dateRange(start, end time.Time) string {
+	name := start.Format(dateFormat)
+	if endDate := end.Format(dateFormat); endDate != name {
+		name += "_" + endDate
+	}
+	return name
+}
+
+// Find clusters the items into events by the gaps between when they were taken, items without a time are left out
+func Find(items []Item, opts Options) []Event {
+	if !opts.Enabled() {
+		return nil
+	}
+
+	sorted := make([]Item, 0, len(items))
+	for _, item := range items {
+		if !item.Time.IsZero() {
+			sorted = append(sorted, item)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Time.Equal(sorted[j].Time) {
+			return sorted[i].ID < sorted[j].ID
+		}
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	var events []Event
+	var lastLocation *metadata.Location
+	for i, item := range sorted {
+		if i == 0 || isNewEvent(sorted[i-1], item, lastLocation, opts) {
+			events = append(events, Event{Start: item.Time})
+		}
+		e := &events[len(events)-1]
+		e.End = item.Time
+		e.IDs = append(e.IDs, item.ID)
+		if item.Location != nil {
+			lastLocation = item.Location
+			if e.Location == nil {
+				e.Location = item.Location
+			}
+		}
+	}
+	return events
+}
+
+func isNewEvent(previous, item Item, lastLocation *metadata.Location, opts Options) bool {
+	if item.Time.Sub(previous.Time) > opts.Gap {
+		return true
+	}
+	return opts.MaxDistanceKm > 0 && lastLocation != nil && item.Location != nil &&
+		geocode.DistanceKm(*lastLocation, *item.Location) > opts.MaxDistanceKm
+}
+
+// Store being the events from previous runs, so labels and event folders are kept when more files
+// are sorted, including videos sorted in a separate run to the images taken at the same time
+type Store struct {
+	path   string
+	Events []Event `json:"events"`
+}
+
+// ReadStore reads the events file from the destination path, which is empty before the first run
+func ReadStore(destinationPath string) (*Store, error) {
+	s := &Store{path: filepath.Join(destinationPath, FileName)}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events file: %w", err)
+	}
+	err = json.Unmarshal(data, s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse events file %s: %w", s.path, err)
+	}
+	// events stored before they had a key keep the folder they were named after
+	for i, e := range s.Events {
+		if e.Key == "" {
+			s.Events[i].Key = dateRange(e.Start, e.End)
+		}
+	}
+	return s, nil
+}
+
+// Merge matches the events found in this run to those already stored, an event within the gap of a stored
+// one, and not further away than the max distance, takes its label and key and extends it. The others are stored
+// as new events, which aren't matched to each other as Find has already split them
+func (s *Store) Merge(events []Event, opts Options) []Event {
+	storedBefore := len(s.Events)
+	stored := make([]int, len(events))
+	for i, e := range events {
+		stored[i] = -1
+		for j := 0; j < storedBefore; j++ {
+			if isSameEvent(s.Events[j], e, opts) {
+				stored[i] = j
+				break
+			}
+		}
+		if stored[i] == -1 {
+			s.Events = append(s.Events, Event{Start: e.Start, End: e.End, Key: s.newKey(e), Location: e.Location})
+			stored[i] = len(s.Events) - 1
+			continue
+		}
+
+		existing := &s.Events[stored[i]]
+		if e.Start.Before(existing.Start) {
+			existing.Start = e.Start
+		}
+		if e.End.After(existing.End) {
+			existing.End = e.End
+		}
+		if existing.Location == nil {
+			existing.Location = e.Location
+		}
+	}
+
+	merged := make([]Event, len(events))
+	for i, e := range events {
+		existing := s.Events[stored[i]]
+		merged[i] = Event{Start: existing.Start, End: existing.End, Label: existing.Label, Key: existing.Key,
+			Location: existing.Location, IDs: e.IDs}
+	}
+	sort.Slice(s.Events, func(i, j int) bool { return s.Events[i].Start.Before(s.Events[j].Start) })
+	return merged
+}
+
+func isSameEvent(existing, e Event, opts Options) bool {
+	if e.Start.After(existing.End.Add(opts.Gap)) || e.End.Before(existing.Start.Add(-opts.Gap)) {
+		return false
+	}
+	return opts.MaxDistanceKm <= 0 || existing.Location == nil || e.Location == nil ||
+		geocode.DistanceKm(*existing.Location, *e.Location) <= opts.MaxDistanceKm
+}
+
+// newKey gets the key of an event being stored, its date range with a number after it when another event
+// already has that key, such as a morning and an evening on the same day
+func (s *Store) newKey(e Event) string {
+	key := dateRange(e.Start, e.End)
+	for n := 2; s.hasKey(key); n++ {
+		key = fmt.Sprintf("%s (%d)", dateRange(e.Start, e.End), n)
+	}
+	return key
+}
+
+func (s *Store) hasKey(key string) bool {
+	for _, e := range s.Events {
+		if e.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup gets the event a file taken at the time would join without changing the store, the stored event it is
+// within the gap of or otherwise a new event of its own
+func (s *Store) Lookup(t time.Time, gap time.Duration) Event {
+	for _, existing := range s.Events {
+		if !t.After(existing.End.Add(gap)) && !t.Before(existing.Start.Add(-gap)) {
+			return existing
+		}
+	}
+	return Event{Start: t, End: t}
+}
+
+// SetLabel labels a stored event, getting the event and the folder name it had before. The event is given by
+// its key or folder name, or by a date in the format "yyyy-mm-dd" when only one event was happening on it.
+// When there were more, the date is followed by which of them such as "2024-05-01#2", and the error lists them.
+func (s *Store) SetLabel(event, label string) (Event, string, error) {
+	if strings.ContainsAny(label, `/\`) {
+		return Event{}, "", fmt.Errorf("label %q must not contain folders", label)
+	}
+	i, err := s.find(event)
+	if err != nil {
+		return Event{}, "", err
+	}
+	previousName := s.Events[i].Name()
+	s.Events[i].Label = label
+	return s.Events[i], previousName, nil
+}
+
+// find gets the index of the stored event given as for SetLabel
+func (s *Store) find(event string) (int, error) {
+	date, index := event, 0
+	if d, n, ok := strings.Cut(event, "#"); ok {
+		var err error
+		date = d
+		index, err = strconv.Atoi(n)
+		if err != nil || index < 1 {
+			return 0, fmt.Errorf("invalid event number %q in %q", n, event)
+		}
+	}
+
+	day, err := time.Parse(dateFormat, date)
+	if err != nil {
+		for i, e := range s.Events {
+			if e.Key == event || e.Name() == event {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("no event named %q, expected its folder name or a yyyy-mm-dd date", event)
+	}
+
+	var candidates []int
+	for i, e := range s.Events {
+		if !day.After(e.End) && day.Add(24*time.Hour).After(e.Start) {
+			candidates = append(candidates, i)
+		}
+	}
+	switch {
+	case len(candidates) == 0:
+		return 0, fmt.Errorf("no event found on %s", date)
+	case index > len(candidates):
+		return 0, fmt.Errorf("there are %d events on %s, not %d", len(candidates), date, index)
+	case index > 0:
+		return candidates[index-1], nil
+	case len(candidates) == 1:
+		return candidates[0], nil
+	}
+
+	listed := make([]string, len(candidates))
+	for n, i := range candidates {
+		e := s.Events[i]
+		listed[n] = fmt.Sprintf("%s#%d for %q from %s to %s", date, n+1, e.Name(),
+			e.Start.Format(time.DateTime), e.End.Format(time.DateTime))
+	}
+	return 0, fmt.Errorf("%d events on %s, give one of %s", len(candidates), date, strings.Join(listed, ", "))
+}
+
+// RenameFolders renames the folders in the destination path named after an event, such as after it is labelled,
+// getting the folders that were renamed. A folder whose new name is already taken is left as it is.
+func RenameFolders(destinationPath, oldName, newName string) ([]string, error) {
+	var folders []string
+	err := filepath.WalkDir(destinationPath, func(path string, e os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.IsDir() && path != destinationPath && e.Name() == oldName {
+			folders = append(folders, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find event folders: %w", err)
+	}
+
+	var renamed []string
+	var errs []error
+	for _, folder := range folders {
+		dest := filepath.Join(filepath.Dir(folder), newName)
+		if _, err := os.Stat(dest); err == nil {
+			errs = append(errs, fmt.Errorf("failed to rename %s, %s already exists", folder, dest))
+			continue
+		}
+		if err := os.Rename(folder, dest); err != nil {
+			errs = append(errs, fmt.Errorf("failed to rename event folder: %w", err))
+			continue
+		}
+		renamed = append(renamed, dest)
+	}
+	return renamed, errors.Join(errs...)
+}
+
+func (s *Store) Write() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal events: %w", err)
+	}
+	err = os.WriteFile(s.path, data, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to write events file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package event
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/photos-sorter/pkg/metadata"
+)
+
+var (
+	london = &metadata.Location{Latitude: 51.5074, Longitude: -0.1278}
+	paris  = &metadata.Location{Latitude: 48.8566, Longitude: 2.3522}
+)
+
+func TestMergeTwoPlaces(t *testing.T) {
+	opts := Options{Gap: 4 * time.Hour, MaxDistanceKm: 50}
+	start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	s := &Store{}
+
+	events := s.Merge(Find([]Item{
+		{ID: "london", Time: start, Location: london},
+		{ID: "paris", Time: start.Add(time.Hour), Location: paris},
+	}, opts), opts)
+	if len(events) != 2 || len(s.Events) != 2 {
+		t.Fatalf("got %d events and %d stored, want 2 of each", len(events), len(s.Events))
+	}
+	if events[0].Name() != "2024-05-01" || events[1].Name() != "2024-05-01 (2)" {
+		t.Errorf("got events %q and %q, want %q and %q", events[0].Name(), events[1].Name(),
+			"2024-05-01", "2024-05-01 (2)")
+	}
+
+	// a later run's files join the stored event they were close to
+	events = s.Merge(Find([]Item{
+		{ID: "paris later", Time: start.Add(3 * time.Hour), Location: paris},
+	}, opts), opts)
+	if len(events) != 1 || events[0].Name() != "2024-05-01 (2)" {
+		t.Fatalf("got %+v, want the paris event", events)
+	}
+	if len(s.Events) != 2 {
+		t.Errorf("got %d stored events, want 2", len(s.Events))
+	}
+}
+
+func TestSetLabel(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	newStore := func() *Store {
+		return &Store{Events: []Event{
+			{Start: day.Add(9 * time.Hour), End: day.Add(11 * time.Hour), Key: "2024-05-01"},
+			{Start: day.Add(18 * time.Hour), End: day.Add(20 * time.Hour), Key: "2024-05-01 (2)"},
+			{Start: day.Add(48 * time.Hour), End: day.Add(72 * time.Hour), Key: "2024-05-03_2024-05-04"},
+		}}
+	}
+	tests := []struct {
+		event   string
+		want    string
+		wantErr string
+	}{
+		{event: "2024-05-01", wantErr: `2024-05-01#1 for "2024-05-01" from 2024-05-01 09:00:00`},
+		{event: "2024-05-01#2", want: "2024-05-01 (2)"},
+		{event: "2024-05-01 (2)", want: "2024-05-01 (2)"},
+		{event: "2024-05-04", want: "2024-05-03_2024-05-04"},
+		{event: "2024-05-03_2024-05-04", want: "2024-05-03_2024-05-04"},
+		{event: "2024-05-01#3", wantErr: "there are 2 events on 2024-05-01"},
+		{event: "2024-05-02", wantErr: "no event found on 2024-05-02"},
+		{event: "holiday", wantErr: `no event named "holiday"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+			e, previousName, err := newStore().SetLabel(tt.event, "Beach")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to label: %v", err)
+			}
+			if previousName != tt.want || e.Name() != tt.want+" Beach" {
+				t.Errorf("got %q renamed to %q, want %q renamed to %q", previousName, e.Name(), tt.want, tt.want+" Beach")
+			}
+		})
+	}
+
+	// a labelled event can be given by its folder name
+	s := newStore()
+	if _, _, err := s.SetLabel("2024-05-01#1", "Beach"); err != nil {
+		t.Fatal(err)
+	}
+	if e, _, err := s.SetLabel("2024-05-01 Beach", "Coast"); err != nil || e.Name() != "2024-05-01 Coast" {
+		t.Errorf("got %q, %v relabelling by folder name, want %q", e.Name(), err, "2024-05-01 Coast")
+	}
+}
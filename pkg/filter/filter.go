@@ -0,0 +1,126 @@
+package filter
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/photos-sorter/pkg/genutils"
+)
+
+// DefaultExcludePaths being the folders and files nas drives, macs and windows leave alongside photos,
+// such as synology's "@eaDir" thumbnails, used when no paths to exclude are given
+var DefaultExcludePaths = []string{"@eaDir", "#recycle", "$RECYCLE.BIN", ".Trash*", "Trash", ".DS_Store", "._*"}
+
+// Filter being which files are sorted, the zero value keeps every file. Files have to match all of the
+// includes that are given and none of the excludes. Paths are globs, relative to the source path, where
+// a glob without a "/" such as "@eaDir" matches any folder or file with that name.
+type Filter struct {
+	// From and To being the capture date range, To is exclusive
+	From time.Time
+	To   time.Time
+
+	IncludeCameraModels []*regexp.Regexp
+	ExcludeCameraModels []*regexp.Regexp
+	IncludeExtensions   []string
+	ExcludeExtensions   []string
+
+	// MinSize and MaxSize being the file size in bytes
+	MinSize int64
+	MaxSize int64
+
+	IncludePaths []string
+	ExcludePaths []string
+}
+
+// CheckDir gets why a folder is filtered out, its whole contents are skipped
+func (f Filter) CheckDir(relPath string) (string, bool) {
+	if glob, ok := matchGlob(f.ExcludePaths, relPath); ok {
+		return fmt.Sprintf("folder matches excluded path %q", glob), true
+	}
+	return "", false
+}
+
+// CheckPath gets why a file is filtered out by its path alone
+func (f Filter) CheckPath(relPath string) (string, bool) {
+	if glob, ok := matchGlob(f.ExcludePaths, relPath); ok {
+		return fmt.Sprintf("path matches excluded path %q", glob), true
+	}
+	if _, ok := matchGlob(f.IncludePaths, relPath); len(f.IncludePaths) > 0 && !ok {
+		return "path doesn't match any included path", true
+	}
+	return "", false
+}
+
+// CheckFile gets why a file is filtered out by its path, extension or size
+func (f Filter) CheckFile(relPath string, size int64) (string, bool) {
+	if reason, filtered := f.CheckPath(relPath); filtered {
+		return reason, true
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(relPath), "."))
+	switch {
+	case len(f.IncludeExtensions) > 0 && !genutils.InArray(f.IncludeExtensions, ext):
+		return fmt.Sprintf("extension %q isn't included", ext), true
+	case genutils.InArray(f.ExcludeExtensions, ext):
+		return fmt.Sprintf("extension %q is excluded", ext), true
+	case f.MinSize > 0 && size < f.MinSize:
+		return fmt.Sprintf("size %d is less than %d bytes", size, f.MinSize), true
+	case f.MaxSize > 0 && size > f.MaxSize:
+		return fmt.Sprintf("size %d is more than %d bytes", size, f.MaxSize), true
+	}
+	return "", false
+}
+
+// CheckMetadata gets why a file is filtered out by when it was taken or the camera that took it,
+// files without a capture time are filtered out when there is a date range
+func (f Filter) CheckMetadata(timestamp time.Time, cameraModel string) (string, bool) {
+	hasDateRange := !f.From.IsZero() || !f.To.IsZero()
+	switch {
+	case hasDateRange && timestamp.IsZero():
+		return "no capture time to check against the date range", true
+	case !f.From.IsZero() && timestamp.Before(f.From):
+		return fmt.Sprintf("taken on %s, before %s",
+			timestamp.Format(time.DateOnly), f.From.Format(time.DateOnly)), true
+	case !f.To.IsZero() && !timestamp.Before(f.To):
+		return fmt.Sprintf("taken on %s, after %s",
+			timestamp.Format(time.DateOnly), f.To.AddDate(0, 0, -1).Format(time.DateOnly)), true
+	case len(f.IncludeCameraModels) > 0 && !matchesAny(f.IncludeCameraModels, cameraModel):
+		return fmt.Sprintf("camera model %q isn't included", cameraModel), true
+	case matchesAny(f.ExcludeCameraModels, cameraModel):
+		return fmt.Sprintf("camera model %q is excluded", cameraModel), true
+	}
+	return "", false
+}
+
+func matchesAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob gets the first glob that matches the whole relative path, or for globs without a "/"
+// any one of its folders or its name
+func matchGlob(globs []string, relPath string) (string, bool) {
+	relPath = path.Clean(strings.ReplaceAll(relPath, `\`, "/"))
+	parts := strings.Split(relPath, "/")
+	for _, glob := range globs {
+		if !strings.Contains(glob, "/") {
+			for _, part := range parts {
+				if ok, _ := path.Match(glob, part); ok {
+					return glob, true
+				}
+			}
+			continue
+		}
+		if ok, _ := path.Match(strings.Trim(glob, "/"), relPath); ok {
+			return glob, true
+		}
+	}
+	return "", false
+}
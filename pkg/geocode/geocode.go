@@ -0,0 +1,271 @@
+package geocode
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/photos-sorter/pkg/metadata"
+)
+
+const (
+	earthRadiusKm = 6371.0
+	kmPerDegree   = 111.0
+
+	DefaultMaxDistanceKm = 50.0
+	// DefaultCountryDistanceKm being how far a file can be from the nearest place for just its country to be used
+	DefaultCountryDistanceKm = 500.0
+
+	// geoNamesFields being the columns of a GeoNames cities file, and geoNamesMaxLine the longest line read as
+	// the alternate names can be long
+	geoNamesFields  = 19
+	geoNamesMaxLine = 1 << 20
+)
+
+// places being the bundled dataset of towns, cities and national parks with their region and country
+//
+//go:embed places.csv
+var places string
+
+// Place being the nearest known place to a location
+type Place struct {
+	Name    string
+	Region  string
+	Country string
+}
+
+// Geocoder finds the nearest place to a location without any network calls, places are bucketed
+// by whole degree of latitude and longitude so only those close by are checked
+type Geocoder struct {
+	cells             map[cell][]entry
+	maxDistanceKm     float64
+	countryDistanceKm float64
+}
+
+type cell struct {
+	lat int
+	lon int
+}
+
+type entry struct {
+	place    Place
+	location metadata.Location
+}
+
+// New loads the places from the dataset file, or the bundled dataset when no path is given.
+// The dataset is either a csv with the header "place,region,country,latitude,longitude", or a GeoNames
+// cities file such as cities1000.txt, see readGeoNames
+func New(path string, maxDistanceKm, countryDistanceKm float64) (*Geocoder, error) {
+	if maxDistanceKm <= 0 {
+		maxDistanceKm = DefaultMaxDistanceKm
+	}
+	if countryDistanceKm <= 0 {
+		countryDistanceKm = DefaultCountryDistanceKm
+	}
+
+	var entries []entry
+	var err error
+	switch {
+	case path == "":
+		entries, err = readPlaces(strings.NewReader(places))
+	case strings.EqualFold(filepath.Ext(path), ".txt"):
+		entries, err = readGeoNames(path)
+	default:
+		var f *os.File
+		f, err = os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open places dataset: %w", err)
+		}
+		defer f.Close()
+		entries, err = readPlaces(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("places dataset is empty")
+	}
+
+	g := &Geocoder{
+		cells:             make(map[cell][]entry),
+		maxDistanceKm:     maxDistanceKm,
+		countryDistanceKm: max(countryDistanceKm, maxDistanceKm),
+	}
+	for _, e := range entries {
+		c := cellOf(e.location)
+		g.cells[c] = append(g.cells[c], e)
+	}
+	return g, nil
+}
+
+func readPlaces(r io.Reader) ([]entry, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read places dataset: %w", err)
+	}
+	if len(records) < 2 {
+		return nil, nil
+	}
+
+	entries := make([]entry, 0, len(records)-1)
+	for i, record := range records[1:] {
+		if len(record) != 5 {
+			return nil, fmt.Errorf("line %d of places dataset has %d fields, expected 5", i+2, len(record))
+		}
+		location, err := parseLocation(record[3], record[4])
+		if err != nil {
+			return nil, fmt.Errorf("line %d of places dataset %w", i+2, err)
+		}
+		entries = append(entries, entry{
+			place:    Place{Name: record[0], Region: record[1], Country: record[2]},
+			location: location,
+		})
+	}
+	return entries, nil
+}
+
+// readGeoNames reads a GeoNames cities file, the region and country names are read from admin1CodesASCII.txt
+// and countryInfo.txt next to it when they are there, otherwise their codes are used
+func readGeoNames(path string) ([]entry, error) {
+	regions, err := readGeoNamesNames(filepath.Join(filepath.Dir(path), "admin1CodesASCII.txt"), 1)
+	if err != nil {
+		return nil, err
+	}
+	countries, err := readGeoNamesNames(filepath.Join(filepath.Dir(path), "countryInfo.txt"), 4)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open places dataset: %w", err)
+	}
+	defer f.Close()
+
+	var entries []entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), geoNamesMaxLine)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < geoNamesFields {
+			return nil, fmt.Errorf("line %d of places dataset has %d fields, expected %d", line, len(fields),
+				geoNamesFields)
+		}
+		location, err := parseLocation(fields[4], fields[5])
+		if err != nil {
+			return nil, fmt.Errorf("line %d of places dataset %w", line, err)
+		}
+		countryCode, regionCode := fields[8], fields[8]+"."+fields[10]
+		place := Place{Name: fields[1], Region: regions[regionCode], Country: countries[countryCode]}
+		if place.Country == "" {
+			place.Country = countryCode
+		}
+		entries = append(entries, entry{place: place, location: location})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read places dataset: %w", err)
+	}
+	return entries, nil
+}
+
+// readGeoNamesNames reads the names keyed by code from a GeoNames tab separated file, skipping its comments
+func readGeoNamesNames(path string, nameField int) (map[string]string, error) {
+	names := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return names, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, "\t")
+		if strings.HasPrefix(line, "#") || len(fields) <= nameField {
+			continue
+		}
+		names[fields[0]] = fields[nameField]
+	}
+	return names, nil
+}
+
+func parseLocation(latitude, longitude string) (metadata.Location, error) {
+	lat, err := strconv.ParseFloat(latitude, 64)
+	if err != nil {
+		return metadata.Location{}, fmt.Errorf("has an invalid latitude: %w", err)
+	}
+	lon, err := strconv.ParseFloat(longitude, 64)
+	if err != nil {
+		return metadata.Location{}, fmt.Errorf("has an invalid longitude: %w", err)
+	}
+	return metadata.Location{Latitude: lat, Longitude: lon}, nil
+}
+
+// Lookup finds the nearest place within the max distance of the location, or when there isn't one,
+// just the country of the nearest place within the country distance
+func (g *Geocoder) Lookup(location metadata.Location) (Place, bool) {
+	if g == nil {
+		return Place{}, false
+	}
+	if nearest, ok := g.nearest(location, g.maxDistanceKm); ok {
+		return nearest.place, true
+	}
+	if nearest, ok := g.nearest(location, g.countryDistanceKm); ok {
+		return Place{Country: nearest.place.Country}, true
+	}
+	return Place{}, false
+}
+
+func (g *Geocoder) nearest(location metadata.Location, maxDistanceKm float64) (entry, bool) {
+	// longitude degrees get shorter towards the poles, so more cells are checked
+	latCells := int(math.Ceil(maxDistanceKm / kmPerDegree))
+	lonCells := 180
+	if cos := math.Cos(location.Latitude * math.Pi / 180); cos > 0.01 {
+		lonCells = min(int(math.Ceil(maxDistanceKm/(kmPerDegree*cos))), 180)
+	}
+
+	var nearest *entry
+	nearestKm := maxDistanceKm
+	c := cellOf(location)
+	for lat := c.lat - latCells; lat <= c.lat+latCells; lat++ {
+		for lon := c.lon - lonCells; lon <= c.lon+lonCells; lon++ {
+			entries := g.cells[cell{lat: lat, lon: wrapLongitude(lon)}]
+			for i := range entries {
+				if km := DistanceKm(location, entries[i].location); km <= nearestKm {
+					nearest = &entries[i]
+					nearestKm = km
+				}
+			}
+		}
+	}
+	if nearest == nil {
+		return entry{}, false
+	}
+	return *nearest, true
+}
+
+// DistanceKm is the great circle distance between two locations
+func DistanceKm(a, b metadata.Location) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func cellOf(l metadata.Location) cell {
+	return cell{lat: int(math.Floor(l.Latitude)), lon: int(math.Floor(l.Longitude))}
+}
+
+// wrapLongitude keeps a cell's longitude within -180 to 179, so places either side of the antimeridian are found
+func wrapLongitude(lon int) int {
+	return ((lon+180)%360+360)%360 - 180
+}
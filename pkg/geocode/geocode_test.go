@@ -0,0 +1,80 @@
+package geocode
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/photos-sorter/pkg/metadata"
+)
+
+func TestLookup(t *testing.T) {
+	g, err := New("", DefaultMaxDistanceKm, DefaultCountryDistanceKm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		location metadata.Location
+		want     Place
+		found    bool
+	}{
+		{
+			name:     "nearest place",
+			location: metadata.Location{Latitude: 51.5010, Longitude: -0.1416},
+			want:     Place{Name: "London", Region: "England", Country: "United Kingdom"},
+			found:    true,
+		},
+		{
+			name:     "country of a place too far away",
+			location: metadata.Location{Latitude: 57.15, Longitude: 0.5},
+			want:     Place{Country: "United Kingdom"},
+			found:    true,
+		},
+		{
+			name:     "nowhere near a place",
+			location: metadata.Location{Latitude: 40, Longitude: -40},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			place, ok := g.Lookup(tt.location)
+			if ok != tt.found || place != tt.want {
+				t.Errorf("got %+v %v, want %+v %v", place, ok, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestGeoNames(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"cities1000.txt": "2643743\tLondon\tLondon\t\t51.50853\t-0.12574\tP\tPPLC\tGB\t\tENG\tGLA\t\t\t8961989\t\t25\tEurope/London\t2023-01-01\n" +
+			"2988507\tParis\tParis\t\t48.85341\t2.3488\tP\tPPLC\tFR\t\t11\t75\t751\t75056\t2138551\t\t42\tEurope/Paris\t2023-01-01\n",
+		"admin1CodesASCII.txt": "GB.ENG\tEngland\tEngland\t6269131\n",
+		"countryInfo.txt":      "#ISO\tISO3\tISO-Numeric\tfips\tCountry\nGB\tGBR\t826\tUK\tUnited Kingdom\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g, err := New(filepath.Join(dir, "cities1000.txt"), DefaultMaxDistanceKm, DefaultCountryDistanceKm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// paris's region and country aren't in the names files, so their codes are used
+	for _, want := range []struct {
+		location metadata.Location
+		place    Place
+	}{
+		{metadata.Location{Latitude: 51.5010, Longitude: -0.1416}, Place{Name: "London", Region: "England", Country: "United Kingdom"}},
+		{metadata.Location{Latitude: 48.8606, Longitude: 2.3376}, Place{Name: "Paris", Country: "FR"}},
+	} {
+		if place, ok := g.Lookup(want.location); !ok || place != want.place {
+			t.Errorf("got %+v, want %+v", place, want.place)
+		}
+	}
+}
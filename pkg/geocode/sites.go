@@ -0,0 +1,74 @@
+package geocode
+
+import (
+	"strings"
+
+	"github.com/photos-sorter/pkg/metadata"
+)
+
+// Site being a named place such as where a trail camera is mounted, found either by its gps
+// polygon, a radius around its centre, or the serial numbers of the cameras kept there
+type Site struct {
+	Name          string
+	Polygon       []metadata.Location
+	Center        *metadata.Location
+	RadiusMeters  float64
+	CameraSerials []string
+}
+
+// Sites are checked in order, with camera serial numbers matched before any gps coordinates
+type Sites []Site
+
+// Find gets the name of the site a file is from, by the serial number of the camera that took it
+// or by where it was taken
+func (s Sites) Find(cameraSerial string, location metadata.Location, hasLocation bool) (string, bool) {
+	if cameraSerial != "" {
+		for _, site := range s {
+			for _, serial := range site.CameraSerials {
+				if strings.EqualFold(strings.TrimSpace(serial), strings.TrimSpace(cameraSerial)) {
+					return site.Name, true
+				}
+			}
+		}
+	}
+	if hasLocation {
+		for _, site := range s {
+			if site.Contains(location) {
+				return site.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// UsesCameraSerials is whether any site is found by the serial numbers of its cameras
+func (s Sites) UsesCameraSerials() bool {
+	for _, site := range s {
+		if len(site.CameraSerials) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains is whether the location is inside the site's polygon or within its radius
+func (s Site) Contains(location metadata.Location) bool {
+	if s.Center != nil && s.RadiusMeters > 0 && DistanceKm(*s.Center, location)*1000 <= s.RadiusMeters {
+		return true
+	}
+	return len(s.Polygon) >= 3 && inPolygon(s.Polygon, location)
+}
+
+// inPolygon uses ray casting, treating latitude and longitude as flat which is close enough for
+// the size of a site
+func inPolygon(polygon []metadata.Location, l metadata.Location) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Latitude > l.Latitude) != (b.Latitude > l.Latitude) &&
+			l.Longitude < (b.Longitude-a.Longitude)*(l.Latitude-a.Latitude)/(b.Latitude-a.Latitude)+a.Longitude {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -1,6 +1,7 @@
 package logging
 
 import (
+	"io"
 	"os"
 
 	"go.uber.org/zap"
@@ -8,6 +9,11 @@ import (
 )
 
 func NewLogger(level string) *zap.Logger {
+	return NewLoggerTo(level, os.Stdout)
+}
+
+// NewLoggerTo logs to the output, such as the progress display's so logs are written above its bar
+func NewLoggerTo(level string, out io.Writer) *zap.Logger {
 	var lvl zapcore.Level
 	switch level {
 	case "debug":
@@ -38,8 +44,7 @@ func NewLogger(level string) *zap.Logger {
 	// Use a custom console encoder for pretty printing
 	encoder := zapcore.NewConsoleEncoder(encoderConfig)
 
-	// Output to console
-	logOutput := zapcore.AddSync(os.Stdout)
+	logOutput := zapcore.AddSync(out)
 
 	// Create a core to write logs to standard output
 	core := zapcore.NewCore(encoder, logOutput, lvl)
@@ -0,0 +1,231 @@
+package metadata
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/barasher/go-exiftool"
+	"go.uber.org/zap"
+)
+
+// exiftoolBatchSize being how many files are passed to an exiftool process at a time
+const exiftoolBatchSize = 100
+
+var (
+	// exiftoolDateFields being where each file type keeps its capture date, most trusted first.
+	// apple's CreationDate is the local time a video was taken rather than the utc CreateDate,
+	// avchd and matroska have it in DateTimeOriginal, asf (wmv) in CreationDate and mpeg often has none
+	exiftoolDateFields = map[string][]string{
+		"mp4":  {"CreationDate", "CreateDate"},
+		"mov":  {"CreationDate", "CreateDate"},
+		"m4v":  {"CreationDate", "CreateDate"},
+		"3gp":  {"CreationDate", "CreateDate"},
+		"3g2":  {"CreationDate", "CreateDate"},
+		"avi":  {"DateTimeOriginal"},
+		"mts":  {"DateTimeOriginal"},
+		"m2ts": {"DateTimeOriginal"},
+		"mkv":  {"DateTimeOriginal"},
+		"wmv":  {"CreationDate", "DateTimeOriginal"},
+		"mpg":  {"DateTimeOriginal", "FileModifyDate"},
+		"mpeg": {"DateTimeOriginal", "FileModifyDate"},
+	}
+	defaultExiftoolDateFields = []string{"SubSecDateTimeOriginal", "DateTimeOriginal", "CreateDate"}
+
+	// exiftoolOrientations being exiftool's descriptions of the exif orientation values
+	exiftoolOrientations = map[string]int{
+		"Horizontal (normal)":                 1,
+		"Mirror horizontal":                   2,
+		"Rotate 180":                          3,
+		"Mirror vertical":                     4,
+		"Mirror horizontal and rotate 270 CW": 5,
+		"Rotate 90 CW":                        6,
+		"Mirror horizontal and rotate 90 CW":  7,
+		"Rotate 270 CW":                       8,
+	}
+
+	exiftoolDurationRegex = regexp.MustCompile(`^(?:([0-9.]+) s|([0-9]+):([0-9]{2}):([0-9]{2}))`)
+)
+
+// ExiftoolExtractor reads any file exiftool understands, it needs the exiftool binary on the path.
+// It keeps a pool of exiftool processes, each reading a batch of files per call.
+type ExiftoolExtractor struct {
+	pool      chan *exiftool.Exiftool
+	processes []*exiftool.Exiftool
+	closeOnce sync.Once
+}
+
+func NewExiftoolExtractor(processes int) (*ExiftoolExtractor, error) {
+	processes = max(processes, 1)
+	e := &ExiftoolExtractor{pool: make(chan *exiftool.Exiftool, processes)}
+	for range processes {
+		et, err := exiftool.NewExiftool(exiftool.CoordFormant("%+.6f"))
+		if err != nil {
+			e.Close()
+			return nil, fmt.Errorf("failed to initialize exiftool: %w", err)
+		}
+		e.processes = append(e.processes, et)
+		e.pool <- et
+	}
+	return e, nil
+}
+
+func (e *ExiftoolExtractor) Name() string {
+	return ExtractorExiftool
+}
+
+func (e *ExiftoolExtractor) Supports(_ string) bool {
+	return true
+}
+
+// Close waits for the processes in use to be returned to the pool then stops them all, it is safe to call more than once
+func (e *ExiftoolExtractor) Close() {
+	e.closeOnce.Do(func() {
+		for range e.processes {
+			et := <-e.pool
+			et.Close()
+		}
+	})
+}
+
+func (e *ExiftoolExtractor) Extract(logger *zap.Logger, path string) (Record, error) {
+	results := e.ExtractBatch(logger, []string{path})
+	return results[0].Record, results[0].Err
+}
+
+// ExtractBatch reads the files in batches of exiftoolBatchSize, spread across the process pool
+func (e *ExiftoolExtractor) ExtractBatch(logger *zap.Logger, paths []string) []Result {
+	results := make([]Result, len(paths))
+	var wg sync.WaitGroup
+	for start := 0; start < len(paths); start += exiftoolBatchSize {
+		end := min(start+exiftoolBatchSize, len(paths))
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			et := <-e.pool
+			fileInfos := et.ExtractMetadata(paths[start:end]...)
+			e.pool <- et
+
+			for i := start; i < end; i++ {
+				results[i] = toExiftoolResult(logger, paths[i], fileInfos, i-start)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return results
+}
+
+// toExiftoolResult finds the file's metadata, which exiftool returns in the order the files were asked for
+func toExiftoolResult(logger *zap.Logger, path string, fileInfos []exiftool.FileMetadata, i int) Result {
+	if i >= len(fileInfos) || fileInfos[i].File != path {
+		i = slices.IndexFunc(fileInfos, func(fm exiftool.FileMetadata) bool { return fm.File == path })
+	}
+	if i < 0 {
+		return Result{Path: path, Err: fmt.Errorf("no metadata returned by exiftool")}
+	}
+	if fileInfos[i].Err != nil {
+		return Result{Path: path, Err: fmt.Errorf("failed to extract metadata: %w", fileInfos[i].Err)}
+	}
+	logger.Debug("read exiftool metadata", zap.String("path", path), zap.Any("fields", fileInfos[i].Fields))
+	return Result{Path: path, Record: toExiftoolRecord(fileInfos[i], path)}
+}
+
+func toExiftoolRecord(fm exiftool.FileMetadata, path string) Record {
+	r := Record{
+		Make:              fieldString(fm, "Make"),
+		Model:             fieldString(fm, "Model"),
+		CameraSerial:      fieldString(fm, "SerialNumber", "InternalSerialNumber"),
+		Lens:              fieldString(fm, "LensModel", "Lens"),
+		Software:          fieldString(fm, "Software", "Encoder"),
+		Width:             int(fieldInt(fm, "ImageWidth")),
+		Height:            int(fieldInt(fm, "ImageHeight")),
+		Orientation:       exiftoolOrientations[fieldString(fm, "Orientation")],
+		Duration:          parseExiftoolDuration(fieldString(fm, "Duration")),
+		ContentIdentifier: fieldString(fm, "ContentIdentifier"),
+		AutoBracket:       fieldString(fm, "ExposureMode") == "Auto bracket",
+	}
+	// some cameras, such as trail cameras, only write their model in the comment
+	if r.Model == "" {
+		r.Model = fieldString(fm, "Comment")
+	}
+	if rotation := fieldInt(fm, "Rotation"); rotation != 0 {
+		r.Orientation = RotationOrientation(int(rotation))
+	}
+	if bias := fieldString(fm, "ExposureCompensation"); bias != "" {
+		r.ExposureBias = parseFraction(bias)
+	}
+
+	lat, latErr := fm.GetFloat("GPSLatitude")
+	lon, lonErr := fm.GetFloat("GPSLongitude")
+	if latErr == nil && lonErr == nil && (lat != 0 || lon != 0) {
+		r.Location = &Location{Latitude: lat, Longitude: lon}
+	}
+
+	dateFields, ok := exiftoolDateFields[Ext(path)]
+	if !ok {
+		dateFields = defaultExiftoolDateFields
+	}
+	for _, field := range dateFields {
+		if t := ParseTimestamp(fieldString(fm, field)); !t.IsZero() {
+			r.Timestamp = t
+			r.TimestampSource = ExtractorExiftool + " " + field
+			break
+		}
+	}
+	return r
+}
+
+// fieldString gets the first of the fields that is set
+func fieldString(fm exiftool.FileMetadata, fields ...string) string {
+	for _, field := range fields {
+		if v, err := fm.GetString(field); err == nil && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func fieldInt(fm exiftool.FileMetadata, field string) int64 {
+	v, err := fm.GetInt(field)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// parseExiftoolDuration parses exiftool's "12.34 s" for short durations and "0:01:23" for longer ones
+func parseExiftoolDuration(duration string) time.Duration {
+	m := exiftoolDurationRegex.FindStringSubmatch(duration)
+	if m == nil {
+		return 0
+	}
+	if m[1] != "" {
+		seconds, _ := strconv.ParseFloat(m[1], 64)
+		return time.Duration(seconds * float64(time.Second))
+	}
+	hours, _ := strconv.Atoi(m[2])
+	minutes, _ := strconv.Atoi(m[3])
+	seconds, _ := strconv.Atoi(m[4])
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+}
+
+// parseFraction parses a value such as "+1/3" or "-0.7"
+func parseFraction(value string) float64 {
+	n, d, ok := strings.Cut(value, "/")
+	numerator, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		return numerator
+	}
+	denominator, err := strconv.ParseFloat(d, 64)
+	if err != nil || denominator == 0 {
+		return 0
+	}
+	return numerator / denominator
+}
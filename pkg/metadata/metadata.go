@@ -0,0 +1,340 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ExtractorImagemeta = "imagemeta"
+	ExtractorQuicktime = "quicktime"
+	ExtractorExiftool  = "exiftool"
+)
+
+var (
+	ErrNoExtractor = errors.New("no metadata extractor available")
+
+	// ExtractorNames being the backends that can be chosen per file type in the config
+	ExtractorNames = []string{ExtractorImagemeta, ExtractorQuicktime, ExtractorExiftool}
+)
+
+// Record being the metadata of an image or video, the same whichever backend read it.
+// Orientation uses the exif values, 1 being upright and 6 rotated 90 degrees clockwise.
+type Record struct {
+	Make              string
+	Model             string
+	CameraSerial      string
+	Lens              string
+	Software          string
+	Width             int
+	Height            int
+	Orientation       int
+	Duration          time.Duration
+	Timestamp         time.Time
+	TimestampSource   string
+	Location          *Location
+	ContentIdentifier string
+	ExposureBias      float64
+	AutoBracket       bool
+}
+
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Extractor reads the metadata of the file types it supports, extractors need to be safe to use concurrently
+type Extractor interface {
+	Name() string
+	Supports(ext string) bool
+	Extract(logger *zap.Logger, path string) (Record, error)
+	Close()
+}
+
+// BatchExtractor is an extractor that reads many files faster in one go than one at a time, such as exiftool
+type BatchExtractor interface {
+	Extractor
+	ExtractBatch(logger *zap.Logger, paths []string) []Result
+}
+
+// Result being the outcome of extracting a file's metadata as part of a batch
+type Result struct {
+	Path   string
+	Record Record
+	Err    error
+}
+
+// Registry picks the extractors for each file, by default every extractor supporting the file type is tried
+// in the order they were given, which can be replaced per file type with a list of extractor names
+type Registry struct {
+	extractors []Extractor
+	fileTypes  map[string][]string
+	closeOnce  sync.Once
+	// readSerials being when a record also needs a camera serial before the rest of the chain is skipped
+	readSerials bool
+}
+
+func NewRegistry(fileTypes map[string][]string, extractors ...Extractor) *Registry {
+	return &Registry{extractors: extractors, fileTypes: fileTypes}
+}
+
+// ReadCameraSerials makes files with a timestamp but no camera serial go on to the next extractor in their
+// chain, whose serial is added to the record, for when sites are found by camera serial. The native quicktime
+// parser only reads the serial from canon movies, so other videos need exiftool for it.
+func (r *Registry) ReadCameraSerials() {
+	r.readSerials = true
+}
+
+func (r *Registry) Name() string {
+	return "registry"
+}
+
+func (r *Registry) Supports(ext string) bool {
+	return len(r.extractorsFor(ext)) > 0
+}
+
+// Get gets the named extractor, if it is available
+func (r *Registry) Get(name string) (Extractor, bool) {
+	for _, e := range r.extractors {
+		if e.Name() == name {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// Extract tries each of the file type's extractors until one finds a timestamp, and a camera serial when
+// reading serials, falling back to the first that read anything at all
+func (r *Registry) Extract(logger *zap.Logger, path string) (Record, error) {
+	s := r.newExtraction(path)
+	for _, e := range s.extractors {
+		record, err := e.Extract(logger, path)
+		s.add(logger, e, Result{Path: path, Record: record, Err: err})
+		if s.done {
+			break
+		}
+	}
+	result := s.result(context.Background(), path)
+	return result.Record, result.Err
+}
+
+// ExtractAll extracts many files with the same fallback rules as Extract. Each round gives every file still
+// without a timestamp to the next extractor in its chain, batch extractors getting all their files at once
+// and others spread across the workers. Files not reached before the context is done get its error.
+func (r *Registry) ExtractAll(ctx context.Context, logger *zap.Logger, paths []string, workers int) []Result {
+	states := make([]extraction, len(paths))
+	for i, path := range paths {
+		states[i] = r.newExtraction(path)
+	}
+
+	for round := 0; ; round++ {
+		pending := map[Extractor][]int{}
+		var order []Extractor
+		for i, s := range states {
+			if s.done || round >= len(s.extractors) {
+				continue
+			}
+			e := s.extractors[round]
+			if _, ok := pending[e]; !ok {
+				order = append(order, e)
+			}
+			pending[e] = append(pending[e], i)
+		}
+		if len(order) == 0 {
+			break
+		}
+
+		for _, e := range order {
+			if ctx.Err() != nil {
+				break
+			}
+			indexes := pending[e]
+			batch := make([]string, len(indexes))
+			for j, i := range indexes {
+				batch[j] = paths[i]
+			}
+			for j, result := range extractBatch(logger, e, batch, workers) {
+				states[indexes[j]].add(logger, e, result)
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	results := make([]Result, len(paths))
+	for i, s := range states {
+		results[i] = s.result(ctx, paths[i])
+	}
+	return results
+}
+
+// extraction being the progress of a single file through its extractors
+type extraction struct {
+	extractors  []Extractor
+	readSerials bool
+	done        bool
+	record      *Record
+	errs        []error
+}
+
+func (r *Registry) newExtraction(path string) extraction {
+	return extraction{extractors: r.extractorsFor(Ext(path)), readSerials: r.readSerials}
+}
+
+// add keeps the first record with a timestamp, or the first record at all until there is one, and fills
+// in its camera serial from later records
+func (s *extraction) add(logger *zap.Logger, e Extractor, result Result) {
+	if result.Err != nil {
+		logger.Debug("metadata extractor failed",
+			zap.String("extractor", e.Name()),
+			zap.String("path", result.Path),
+			zap.Error(result.Err))
+		s.errs = append(s.errs, fmt.Errorf("%s: %w", e.Name(), result.Err))
+		return
+	}
+
+	record := result.Record
+	switch {
+	case s.record == nil:
+		s.record = &record
+	case s.record.Timestamp.IsZero() && !record.Timestamp.IsZero():
+		if record.CameraSerial == "" {
+			record.CameraSerial = s.record.CameraSerial
+		}
+		s.record = &record
+	case s.record.CameraSerial == "":
+		s.record.CameraSerial = record.CameraSerial
+	}
+	s.done = !s.record.Timestamp.IsZero() && (!s.readSerials || s.record.CameraSerial != "")
+}
+
+func (s *extraction) result(ctx context.Context, path string) Result {
+	if s.record != nil {
+		return Result{Path: path, Record: *s.record}
+	}
+	if ctx.Err() != nil {
+		return Result{Path: path, Err: ctx.Err()}
+	}
+	if len(s.errs) == 0 {
+		return Result{Path: path, Err: fmt.Errorf("%w for %s files", ErrNoExtractor, Ext(path))}
+	}
+	return Result{Path: path, Err: fmt.Errorf("failed to extract metadata: %w", errors.Join(s.errs...))}
+}
+
+// extractBatch extracts the files with a single extractor, in one batch if it supports it
+func extractBatch(logger *zap.Logger, e Extractor, paths []string, workers int) []Result {
+	if b, ok := e.(BatchExtractor); ok {
+		return b.ExtractBatch(logger, paths)
+	}
+
+	results := make([]Result, len(paths))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				record, err := e.Extract(logger, paths[i])
+				results[i] = Result{Path: paths[i], Record: record, Err: err}
+			}
+		}()
+	}
+	for i := range paths {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// Close closes all the extractors, it is safe to call more than once
+func (r *Registry) Close() {
+	r.closeOnce.Do(func() {
+		for _, e := range r.extractors {
+			e.Close()
+		}
+	})
+}
+
+func (r *Registry) extractorsFor(ext string) []Extractor {
+	names, ok := r.fileTypes[ext]
+	if !ok {
+		var extractors []Extractor
+		for _, e := range r.extractors {
+			if e.Supports(ext) {
+				extractors = append(extractors, e)
+			}
+		}
+		return extractors
+	}
+
+	extractors := make([]Extractor, 0, len(names))
+	for _, name := range names {
+		if e, ok := r.Get(name); ok {
+			extractors = append(extractors, e)
+		}
+	}
+	return extractors
+}
+
+// Ext is the lower case file extension without the dot
+func Ext(path string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// ParseTimestamp parses an exif style timestamp, with a zone offset the local wall clock time is kept
+// so it matches photos from the same camera, avchd adds " DST" during daylight saving
+func ParseTimestamp(timestamp string) time.Time {
+	timestamp = strings.TrimSuffix(timestamp, " DST")
+	if t, err := time.Parse("2006:01:02 15:04:05Z07:00", timestamp); err == nil {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	}
+	if t, err := time.Parse("2006:01:02 15:04:05", timestamp); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+// RotationOrientation converts a video's clockwise rotation in degrees to its exif orientation
+func RotationOrientation(degrees int) int {
+	switch (degrees%360 + 360) % 360 {
+	case 90:
+		return 6
+	case 180:
+		return 3
+	case 270:
+		return 8
+	default:
+		return 1
+	}
+}
+
+var iso6709Regex = regexp.MustCompile(`^([+-][0-9]+(?:\.[0-9]+)?)([+-][0-9]+(?:\.[0-9]+)?)`)
+
+// ParseISO6709 parses a location such as "+51.5074-000.1278+010.000/", as used by quicktime
+func ParseISO6709(location string) *Location {
+	m := iso6709Regex.FindStringSubmatch(location)
+	if m == nil {
+		return nil
+	}
+	lat, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return nil
+	}
+	lon, err := strconv.ParseFloat(m[2], 64)
+	if err != nil {
+		return nil
+	}
+	return &Location{Latitude: lat, Longitude: lon}
+}
@@ -0,0 +1,256 @@
+package pathtemplate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/photos-sorter/pkg/genutils"
+)
+
+const (
+	tokenClass    = "class"
+	tokenYear     = "year"
+	tokenMonth    = "month"
+	tokenDay      = "day"
+	tokenCamera   = "camera"
+	tokenTime     = "time"
+	tokenName     = "name"
+	tokenExt      = "ext"
+	tokenFileName = "filename"
+	tokenCountry  = "country"
+	tokenRegion   = "region"
+	tokenPlace    = "place"
+	tokenSite     = "site"
+	tokenEvent    = "event"
+
+	TokenDate   = "date"
+	TokenSubsec = "subsec"
+	TokenSeq    = "seq"
+	TokenStem   = "stem"
+	TokenHash   = "hash"
+
+	unknownValue = "unknown"
+)
+
+var (
+	pathTokens = []string{tokenClass, tokenYear, tokenMonth, tokenDay, tokenCamera,
+		tokenTime, tokenName, tokenExt, tokenFileName, tokenCountry, tokenRegion, tokenPlace, tokenSite, tokenEvent}
+	nameTokens = []string{TokenDate, tokenTime, TokenSubsec, tokenCamera, TokenSeq,
+		TokenStem, TokenHash, tokenExt}
+)
+
+// Values are what the tokens in a template are replaced with for a single file
+type Values struct {
+	Class  string
+	Camera string
+	// Name is the original file name without its extension
+	Name string
+	Ext  string
+	Time time.Time
+	// FileName is the renamed file name, from executing the name template
+	FileName string
+	Seq      int
+	Hash     string
+	// Country, Region and Place are the nearest known place to where the file was taken
+	Country string
+	Region  string
+	Place   string
+	// Site is the named site, such as where a trail camera is mounted
+	Site string
+	// Event is the name of the event the file was taken at, its date range and any label
+	Event string
+}
+
+type part struct {
+	literal string
+	token   string
+}
+
+// Template is either a destination path relative to the destination folder, such as
+// "{class}/{year}/{month}/{day}/{filename}", or a file name such as "{time}_{stem}{ext}"
+type Template struct {
+	raw   string
+	parts []part
+}
+
+// Set is the templates for a file type, with optional overrides for specific classes
+type Set struct {
+	Default Template
+	Classes map[string]Template
+}
+
+func (s Set) For(class string) Template {
+	if t, ok := s.Classes[class]; ok {
+		return t
+	}
+	return s.Default
+}
+
+// Parse parses a destination path template, which must contain {name} or {filename}
+func Parse(s string) (Template, error) {
+	t, err := parse(s, pathTokens)
+	if err != nil {
+		return t, err
+	}
+	if !t.UsesToken(tokenName) && !t.UsesToken(tokenFileName) {
+		return t, fmt.Errorf("template %q must contain {%s} or {%s} so files don't overwrite each other",
+			s, tokenName, tokenFileName)
+	}
+	if strings.HasPrefix(s, "/") {
+		return t, fmt.Errorf("template %q must be relative to the destination path", s)
+	}
+	for _, folder := range strings.Split(s, "/") {
+		if folder == "" || folder == "." || folder == ".." {
+			return t, fmt.Errorf("template %q has an empty or relative folder", s)
+		}
+	}
+	return t, nil
+}
+
+// ParseName parses a file name template, which must contain {stem}, {hash}, or {seq} along with {date} as
+// the numbers start again each day
+func ParseName(s string) (Template, error) {
+	t, err := parse(s, nameTokens)
+	if err != nil {
+		return t, err
+	}
+	hasSeq := t.UsesToken(TokenSeq) && t.UsesToken(TokenDate)
+	if !t.UsesToken(TokenStem) && !t.UsesToken(TokenHash) && !hasSeq {
+		if t.UsesToken(TokenSeq) {
+			return t, fmt.Errorf("name template %q must contain {%s} along with {%s}, as it starts again each day",
+				s, TokenDate, TokenSeq)
+		}
+		return t, fmt.Errorf("name template %q must contain {%s}, {%s} or {%s} so files don't overwrite each other",
+			s, TokenStem, TokenSeq, TokenHash)
+	}
+	if strings.ContainsAny(s, `/\`) {
+		return t, fmt.Errorf("name template %q must not contain folders", s)
+	}
+	return t, nil
+}
+
+func parse(s string, allowedTokens []string) (Template, error) {
+	t := Template{raw: s}
+	if s == "" {
+		return t, fmt.Errorf("template is empty")
+	}
+
+	rest := s
+	for rest != "" {
+		start := strings.Index(rest, "{")
+		end := strings.Index(rest, "}")
+		switch {
+		case start == -1 && end == -1:
+			t.parts = append(t.parts, part{literal: rest})
+			rest = ""
+			continue
+		case start == -1 || end < start:
+			return t, fmt.Errorf("template %q has an unopened '}'", s)
+		case end == -1:
+			return t, fmt.Errorf("template %q has an unclosed '{'", s)
+		}
+
+		if start > 0 {
+			t.parts = append(t.parts, part{literal: rest[:start]})
+		}
+		token := rest[start+1 : end]
+		if !genutils.InArray(allowedTokens, token) {
+			return t, fmt.Errorf("template %q has unknown token {%s} (choices: %s)",
+				s, token, strings.Join(allowedTokens, ", "))
+		}
+		t.parts = append(t.parts, part{token: token})
+		rest = rest[end+1:]
+	}
+	return t, nil
+}
+
+func (t Template) String() string {
+	return t.raw
+}
+
+func (t Template) UsesToken(token string) bool {
+	for _, p := range t.parts {
+		if p.token == token {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute builds the destination path or file name for a file,
+// empty values that would be a folder name are replaced with "unknown"
+func (t Template) Execute(v Values) string {
+	var sb strings.Builder
+	for _, p := range t.parts {
+		if p.token == "" {
+			sb.WriteString(p.literal)
+			continue
+		}
+		sb.WriteString(tokenValue(p.token, v))
+	}
+	return sb.String()
+}
+
+func tokenValue(token string, v Values) string {
+	switch token {
+	case tokenClass:
+		return orUnknown(v.Class)
+	case tokenYear:
+		return strconv.Itoa(v.Time.Year())
+	case tokenMonth:
+		return genutils.PrefixZeros(2, strconv.Itoa(int(v.Time.Month())))
+	case tokenDay:
+		return genutils.PrefixZeros(2, strconv.Itoa(v.Time.Day()))
+	case TokenDate:
+		return v.Time.Format("20060102")
+	case tokenTime:
+		return v.Time.Format("150405")
+	case TokenSubsec:
+		return genutils.PrefixZeros(3, strconv.Itoa(v.Time.Nanosecond()/int(time.Millisecond)))
+	case tokenCamera:
+		return orUnknown(cleanFolderName(v.Camera))
+	case tokenName, TokenStem:
+		return v.Name
+	case tokenExt:
+		return v.Ext
+	case tokenFileName:
+		return v.FileName
+	case TokenSeq:
+		return genutils.PrefixZeros(4, strconv.Itoa(v.Seq))
+	case TokenHash:
+		return v.Hash
+	case tokenCountry:
+		return orUnknown(cleanPlaceName(v.Country))
+	case tokenRegion:
+		return orUnknown(cleanPlaceName(v.Region))
+	case tokenPlace:
+		return orUnknown(cleanPlaceName(v.Place))
+	case tokenSite:
+		return orUnknown(cleanPlaceName(v.Site))
+	case tokenEvent:
+		return orUnknown(cleanPlaceName(v.Event))
+	}
+	return ""
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return unknownValue
+	}
+	return s
+}
+
+// cleanFolderName makes metadata values such as camera models safe to use as a folder name
+func cleanFolderName(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.NewReplacer("/", "-", "\\", "-", " ", "-", ":", "-").Replace(s)
+	return strings.Trim(s, ".-")
+}
+
+// cleanPlaceName makes a place name safe to use as a folder name, keeping its case and spaces
+func cleanPlaceName(s string) string {
+	s = strings.NewReplacer("/", "-", "\\", "-", ":", "-").Replace(strings.TrimSpace(s))
+	return strings.Trim(s, ".")
+}
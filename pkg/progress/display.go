@@ -0,0 +1,144 @@
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	barInterval = 200 * time.Millisecond
+	logInterval = 10 * time.Second
+
+	barWidth = 24
+	// defaultColumns being the terminal width when the COLUMNS env variable isn't set
+	defaultColumns = 80
+)
+
+// Display shows a tracker's progress, as a bar redrawn in place when the output is a terminal, otherwise
+// as a log line every logInterval
+type Display struct {
+	tracker    *Tracker
+	out        *os.File
+	isTerminal bool
+	columns    int
+
+	// mu guards line, the bar last drawn, which is cleared before anything else is written and drawn again after
+	mu   sync.Mutex
+	line string
+}
+
+func NewDisplay(out *os.File, tracker *Tracker) *Display {
+	d := &Display{tracker: tracker, out: out, columns: defaultColumns}
+	if info, err := out.Stat(); err == nil {
+		d.isTerminal = info.Mode()&os.ModeCharDevice != 0
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		d.columns = columns
+	}
+	return d
+}
+
+// Output being where logs are written so they don't break up the bar, it is the output itself when
+// it isn't a terminal
+func (d *Display) Output() io.Writer {
+	if !d.isTerminal {
+		return d.out
+	}
+	return displayWriter{d}
+}
+
+// Start shows the progress until the context is done or the returned stop is called, which shows it a final time
+func (d *Display) Start(ctx context.Context, logger *zap.Logger) (stop func()) {
+	interval := logInterval
+	if d.isTerminal {
+		interval = barInterval
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.show(logger)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-stopped
+			d.show(logger)
+			if d.isTerminal {
+				d.mu.Lock()
+				defer d.mu.Unlock()
+				io.WriteString(d.out, "\n")
+				d.line = ""
+			}
+		})
+	}
+}
+
+func (d *Display) show(logger *zap.Logger) {
+	s := d.tracker.Snapshot(time.Now())
+	if !d.isTerminal {
+		logger.Info("Progress", zap.Stringer("progress", s))
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.line = d.bar(s)
+	io.WriteString(d.out, "\r\033[K"+d.line)
+}
+
+// bar being such as "[=======>          ]  40% sorting 40/118 | ...", or only the counts until the total is
+// known, cut to the terminal width so it doesn't wrap onto a second line that can't be redrawn
+func (d *Display) bar(s Snapshot) string {
+	line := s.String()
+	if s.Total > 0 {
+		filled := int(s.Fraction() * barWidth)
+		bar := strings.Repeat("=", filled)
+		if filled < barWidth {
+			bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+		}
+		line = fmt.Sprintf("[%s] %3d%% %s", bar, int(s.Fraction()*100), line)
+	}
+	if runes := []rune(line); len(runes) >= d.columns {
+		line = string(runes[:d.columns-1])
+	}
+	return line
+}
+
+// displayWriter clears the bar before writing and draws it again after, so logs are written above it
+type displayWriter struct {
+	d *Display
+}
+
+func (w displayWriter) Write(p []byte) (int, error) {
+	w.d.mu.Lock()
+	defer w.d.mu.Unlock()
+	if w.d.line == "" {
+		return w.d.out.Write(p)
+	}
+
+	io.WriteString(w.d.out, "\r\033[K")
+	n, err := w.d.out.Write(p)
+	io.WriteString(w.d.out, w.d.line)
+	return n, err
+}
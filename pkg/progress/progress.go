@@ -0,0 +1,179 @@
+package progress
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// the stages of a sort, in order
+const (
+	StageFinding  = "finding files"
+	StageGrouping = "grouping"
+	StageSorting  = "sorting"
+)
+
+// Tracker being how many files have been through each stage of a sort, safe to update from many goroutines.
+// The zero value is ready to use.
+type Tracker struct {
+	stage atomic.Pointer[string]
+
+	discovered atomic.Int64
+	extracted  atomic.Int64
+	skipped    atomic.Int64
+	failed     atomic.Int64
+
+	// total being the files to copy or move, known once they have been grouped, and done those that have
+	// been copied, moved, were already in the destination or failed
+	total  atomic.Int64
+	done   atomic.Int64
+	copied atomic.Int64
+	bytes  atomic.Int64
+	// sortStart being when the first file was copied or moved in unix nanoseconds, the speed and time left
+	// are worked out from then
+	sortStart atomic.Int64
+}
+
+func (t *Tracker) SetStage(stage string) {
+	t.stage.Store(&stage)
+}
+
+// SetTotal sets how many files are to be copied or moved
+func (t *Tracker) SetTotal(total int) {
+	t.total.Store(int64(total))
+}
+
+// Discovered counts a file found in the source path
+func (t *Tracker) Discovered() {
+	t.discovered.Add(1)
+}
+
+// Extracted counts a file whose metadata has been read
+func (t *Tracker) Extracted() {
+	t.extracted.Add(1)
+}
+
+// Skipped counts a file that was filtered out
+func (t *Tracker) Skipped() {
+	t.skipped.Add(1)
+}
+
+// Failed counts a file whose metadata couldn't be read
+func (t *Tracker) Failed() {
+	t.failed.Add(1)
+}
+
+// Copied counts a file copied or moved into the destination
+func (t *Tracker) Copied(bytes int64) {
+	t.startSort()
+	t.copied.Add(1)
+	t.bytes.Add(bytes)
+	t.done.Add(1)
+}
+
+// Existing counts a file that wasn't copied or moved as it is already in the destination
+func (t *Tracker) Existing() {
+	t.startSort()
+	t.skipped.Add(1)
+	t.done.Add(1)
+}
+
+// CopyFailed counts a file that couldn't be copied or moved
+func (t *Tracker) CopyFailed() {
+	t.startSort()
+	t.failed.Add(1)
+	t.done.Add(1)
+}
+
+func (t *Tracker) startSort() {
+	t.sortStart.CompareAndSwap(0, time.Now().UnixNano())
+}
+
+// Snapshot being the counts of a tracker at a point in time
+type Snapshot struct {
+	Stage      string
+	Discovered int64
+	Extracted  int64
+	Skipped    int64
+	Failed     int64
+	Total      int64
+	Done       int64
+	Copied     int64
+	Bytes      int64
+
+	// BytesPerSecond and Left being how fast files are being copied and how long until they all are, both
+	// are 0 until the first file is copied, and Left is 0 when the total isn't known
+	BytesPerSecond float64
+	Left           time.Duration
+}
+
+func (t *Tracker) Snapshot(now time.Time) Snapshot {
+	s := Snapshot{
+		Discovered: t.discovered.Load(),
+		Extracted:  t.extracted.Load(),
+		Skipped:    t.skipped.Load(),
+		Failed:     t.failed.Load(),
+		Total:      t.total.Load(),
+		Done:       t.done.Load(),
+		Copied:     t.copied.Load(),
+		Bytes:      t.bytes.Load(),
+	}
+	if stage := t.stage.Load(); stage != nil {
+		s.Stage = *stage
+	}
+
+	start := t.sortStart.Load()
+	if start == 0 {
+		return s
+	}
+	elapsed := now.Sub(time.Unix(0, start))
+	if elapsed <= 0 {
+		return s
+	}
+	s.BytesPerSecond = float64(s.Bytes) / elapsed.Seconds()
+	if s.Done > 0 && s.Total > s.Done {
+		s.Left = time.Duration(float64(elapsed) * float64(s.Total-s.Done) / float64(s.Done)).Round(time.Second)
+	}
+	return s
+}
+
+// Fraction being how much of the sort is done, 0 until the total is known
+func (s Snapshot) Fraction() float64 {
+	if s.Total <= 0 {
+		return 0
+	}
+	return min(float64(s.Done)/float64(s.Total), 1)
+}
+
+// String being the counts on one line, such as
+// "sorting 40/118 | 120 found, 118 read, 2 skipped, 0 failed | 12.3 MB/s, 1m20s left"
+func (s Snapshot) String() string {
+	var b strings.Builder
+	b.WriteString(s.Stage)
+	if s.Total > 0 {
+		fmt.Fprintf(&b, " %d/%d", s.Done, s.Total)
+	}
+	fmt.Fprintf(&b, " | %d found, %d read, %d skipped, %d failed", s.Discovered, s.Extracted, s.Skipped, s.Failed)
+	if s.BytesPerSecond > 0 {
+		fmt.Fprintf(&b, " | %s/s", formatBytes(s.BytesPerSecond))
+		if s.Left > 0 {
+			fmt.Fprintf(&b, ", %s left", s.Left)
+		}
+	}
+	return b.String()
+}
+
+// formatBytes formats bytes such as "12.3 MB", where a KB is 1024 bytes as in the filter sizes
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for bytes >= 1024 && i < len(units)-1 {
+		bytes /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", bytes, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", bytes, units[i])
+}
@@ -0,0 +1,51 @@
+package quality
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Options being the lowest quality an image can have before it is a reject, the zero value rejects none.
+// MinSharpness is the variance of the image's laplacian, lower being blurrier, and MaxClipping is the
+// fraction of pixels that can be pure black or pure white.
+type Options struct {
+	MinSharpness float64
+	MaxClipping  float64
+	// MoveRejects sorts rejects into rejects/, otherwise they are only listed in the report
+	MoveRejects bool
+}
+
+func (o Options) Enabled() bool {
+	return o.MinSharpness > 0 || o.MaxClipping > 0
+}
+
+// Scores being how sharp and well exposed an image is, the clipping being the fraction of its pixels
+// that are crushed to black or blown to white
+type Scores struct {
+	Sharpness  float64
+	Shadows    float64
+	Highlights float64
+}
+
+func (s Scores) String() string {
+	return fmt.Sprintf("sharpness %.1f, %.1f%% shadows and %.1f%% highlights clipped",
+		s.Sharpness, s.Shadows*100, s.Highlights*100)
+}
+
+// Reject gets why the image is a reject, such as "too blurry", or false when it is good enough
+func (o Options) Reject(s Scores) (string, bool) {
+	var reasons []string
+	if o.MinSharpness > 0 && s.Sharpness < o.MinSharpness {
+		reasons = append(reasons, "too blurry")
+	}
+	if o.MaxClipping > 0 && s.Shadows > o.MaxClipping {
+		reasons = append(reasons, "underexposed")
+	}
+	if o.MaxClipping > 0 && s.Highlights > o.MaxClipping {
+		reasons = append(reasons, "overexposed")
+	}
+	if len(reasons) == 0 {
+		return "", false
+	}
+	return strings.Join(reasons, ", "), true
+}
@@ -0,0 +1,113 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const fileNameFormat = "photo-sorter-report-20060102-150405.json"
+
+const (
+	StageMetadata = "metadata"
+	StageMove     = "move"
+)
+
+// Report records what happened to files during a run, it is written as json to the destination
+type Report struct {
+	mu sync.Mutex
+
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Groups    []Group   `json:"groups,omitempty"`
+	Rejects   []Reject  `json:"rejects,omitempty"`
+	Filtered  []Skipped `json:"filtered,omitempty"`
+	Errors    []Error   `json:"errors,omitempty"`
+}
+
+// Group being files that belong together, such as a raw with its jpeg and sidecars
+type Group struct {
+	Type    string `json:"type"`
+	Summary string `json:"summary,omitempty"`
+	Parent  File   `json:"parent"`
+	Members []File `json:"members,omitempty"`
+}
+
+type File struct {
+	Role        string `json:"role,omitempty"`
+	Source      string `json:"source"`
+	Destination string `json:"destination,omitempty"`
+}
+
+// Reject being an image that scored too low on sharpness or exposure, with where it was sorted to
+type Reject struct {
+	Source      string  `json:"source"`
+	Destination string  `json:"destination"`
+	Reason      string  `json:"reason"`
+	Sharpness   float64 `json:"sharpness"`
+	Shadows     float64 `json:"shadows"`
+	Highlights  float64 `json:"highlights"`
+}
+
+// Skipped being a file or folder that was left out of the sort, and why
+type Skipped struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Error being a file that couldn't be handled, stage being what was being done such as "metadata" or "move"
+type Error struct {
+	Path  string `json:"path"`
+	Stage string `json:"stage"`
+	Error string `json:"error"`
+}
+
+func New() *Report {
+	return &Report{StartTime: time.Now()}
+}
+
+func (r *Report) AddGroup(g Group) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Groups = append(r.Groups, g)
+}
+
+func (r *Report) AddReject(reject Reject) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Rejects = append(r.Rejects, reject)
+}
+
+func (r *Report) AddFiltered(path, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Filtered = append(r.Filtered, Skipped{Path: path, Reason: reason})
+}
+
+func (r *Report) AddError(path, stage string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Errors = append(r.Errors, Error{Path: path, Stage: stage, Error: err.Error()})
+}
+
+// Write writes the report into the folder, returning the path of the report file
+func (r *Report) Write(folder string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.EndTime = time.Now()
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal report: %w", err)
+	}
+
+	path := filepath.Join(folder, r.StartTime.Format(fileNameFormat))
+	err = os.WriteFile(path, data, 0640)
+	if err != nil {
+		return "", fmt.Errorf("failed to write report: %w", err)
+	}
+	return path, nil
+}
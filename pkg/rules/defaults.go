@@ -0,0 +1,112 @@
+package rules
+
+var (
+	isRaw      = true
+	noCamera   = false
+	screenSize = true
+)
+
+// messagingFileName being the names messaging apps save images and videos with, such as whatsapp's
+// "IMG-20240501-WA0001", signal's "signal-2024-05-01-123456", telegram's "photo_2024-05-01_12-34-56"
+// and messenger's "received_1234567890"
+const messagingFileName = `^(img|vid|ptt)-\d{8}-wa\d+|^signal-\d{4}-\d{2}-\d{2}|^(photo|video)_\d{4}-\d{2}-\d{2}_|^received_\d+`
+
+// DefaultImageRules sorts images into raw, original, edited, screenshots, messaging, downloads and other,
+// where original is phone heif images straight from the camera, edited is any jpeg from an accepted camera
+// or with a name showing it has been through an editor, and downloads are images without a camera saved
+// from the web or social media
+var DefaultImageRules = RuleSet{
+	Rules: []Rule{
+		{
+			Name:     "raw format",
+			Category: "raw",
+			Match:    Match{Raw: &isRaw},
+		},
+		{
+			Name:     "camera original heif",
+			Category: "original",
+			Match:    Match{Extensions: []string{"heic", "heif"}},
+		},
+		{
+			// such as "Screenshot_20240501-123456_Chrome" on android or "Screen Shot 2024-05-01 at 12.34.56" on macs
+			Name:     "screenshot file name",
+			Category: "screenshots",
+			Match:    Match{FileName: `^(screenshot|screen shot|scr_|screencap)`},
+		},
+		{
+			// iphone screenshots are named like any other photo, but have no camera and are pngs the size of the screen
+			Name:     "screen sized png",
+			Category: "screenshots",
+			Match: Match{
+				Extensions: []string{"png"},
+				HasCamera:  &noCamera,
+				ScreenSize: &screenSize,
+			},
+		},
+		{
+			Name:     "messaging app file name",
+			Category: "messaging",
+			Match:    Match{FileName: messagingFileName},
+		},
+		{
+			Name:     "saved from the web",
+			Category: "downloads",
+			Match: Match{
+				FileName:  `^(download|unnamed|images|fb_img_\d+)( ?\(\d+\))?$`,
+				HasCamera: &noCamera,
+			},
+		},
+		{
+			Name:     "web format without a camera",
+			Category: "downloads",
+			Match: Match{
+				Extensions: []string{"webp", "gif"},
+				HasCamera:  &noCamera,
+			},
+		},
+		{
+			Name:     "accepted camera model",
+			Category: "edited",
+			Match: Match{
+				Extensions:  []string{"jpg", "jpeg"},
+				CameraModel: "canon|dc-fz82",
+			},
+		},
+		{
+			Name:     "edited text",
+			Category: "edited",
+			Match: Match{
+				Extensions: []string{"jpg", "jpeg", "tif", "tiff"},
+				FileName:   "dxo|enhanced|cr3",
+			},
+		},
+		{
+			// a duplicate number such as "_01", "-1", "(1)" or "~1" followed by an editor's suffix
+			Name:     "edit suffix",
+			Category: "edited",
+			Match: Match{
+				Extensions: []string{"jpg", "jpeg", "tif", "tiff"},
+				FileName:   `([_\-~]0?[0-9]|\(0?[0-9]\)|0?[0-9])(e|tz|ps|nr)$`,
+			},
+		},
+	},
+	Default: "other",
+}
+
+// DefaultVideoRules sorts videos from the wildlife cameras into wildlife and those saved from messaging
+// apps into messaging, everything else is other
+var DefaultVideoRules = RuleSet{
+	Rules: []Rule{
+		{
+			Name:     "messaging app file name",
+			Category: "messaging",
+			Match:    Match{FileName: messagingFileName},
+		},
+		{
+			Name:     "wildlife camera model",
+			Category: "wildlife",
+			Match:    Match{CameraModel: "canon|dc-fz82|panasonic|gardepro"},
+		},
+	},
+	Default: "other",
+}
@@ -0,0 +1,228 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/photos-sorter/pkg/genutils"
+)
+
+// Subject is what the rules match against for a single file
+type Subject struct {
+	// FileName is the name without its extension
+	FileName     string
+	Extension    string
+	IsRaw        bool
+	SourceFolder string
+	CameraMake   string
+	CameraModel  string
+	Lens         string
+	Software     string
+	Width        int
+	Height       int
+	// Site is the named site the file was taken at, if any
+	Site string
+}
+
+func (s Subject) hasCamera() bool {
+	return strings.TrimSpace(s.CameraMake) != "" || strings.TrimSpace(s.CameraModel) != ""
+}
+
+// Match is the conditions for a rule, every condition that is set has to match,
+// string conditions are case-insensitive regular expressions
+type Match struct {
+	Extensions   []string `json:"extensions"`
+	Raw          *bool    `json:"raw"`
+	FileName     string   `json:"fileName"`
+	SourceFolder string   `json:"sourceFolder"`
+	CameraMake   string   `json:"cameraMake"`
+	CameraModel  string   `json:"cameraModel"`
+	Lens         string   `json:"lens"`
+	Software     string   `json:"software"`
+	MinWidth     int      `json:"minWidth"`
+	MaxWidth     int      `json:"maxWidth"`
+	MinHeight    int      `json:"minHeight"`
+	MaxHeight    int      `json:"maxHeight"`
+	Site         string   `json:"site"`
+	// HasCamera is whether the file has a camera make or model, which screenshots and images
+	// saved from messaging apps don't
+	HasCamera *bool `json:"hasCamera"`
+	// ScreenSize is whether the dimensions are those of a common phone, tablet or computer screen
+	ScreenSize *bool `json:"screenSize"`
+}
+
+// Rule assigns the category folder to any file that matches
+type Rule struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Match    Match  `json:"match"`
+
+	fileName     *regexp.Regexp
+	sourceFolder *regexp.Regexp
+	cameraMake   *regexp.Regexp
+	cameraModel  *regexp.Regexp
+	lens         *regexp.Regexp
+	software     *regexp.Regexp
+	site         *regexp.Regexp
+}
+
+// RuleSet is the rules for a file type, evaluated in order with the first match winning,
+// the default category is used if none of the rules match
+type RuleSet struct {
+	Rules   []Rule `json:"rules"`
+	Default string `json:"default"`
+}
+
+// rulesFile being rule sets keyed by file type
+type rulesFile map[string]RuleSet
+
+func ReadFile(path string) (map[string]RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+
+	var ruleSets rulesFile
+	err = json.Unmarshal(data, &ruleSets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rules file: %w", err)
+	}
+	return ruleSets, nil
+}
+
+// Compile checks the rule set and compiles its regular expressions, it must be called before Classify
+func (rs RuleSet) Compile() (RuleSet, error) {
+	if rs.Default == "" {
+		return rs, fmt.Errorf("rule set has no default category")
+	}
+
+	compiled := RuleSet{Default: rs.Default, Rules: make([]Rule, 0, len(rs.Rules))}
+	for i, r := range rs.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i)
+		}
+		if r.Category == "" {
+			return rs, fmt.Errorf("%s has no category", r.Name)
+		}
+		if strings.ContainsAny(r.Category, `/\`) {
+			return rs, fmt.Errorf("%s category %q must be a single folder", r.Name, r.Category)
+		}
+
+		var err error
+		for _, c := range []struct {
+			field string
+			expr  string
+			re    **regexp.Regexp
+		}{
+			{"fileName", r.Match.FileName, &r.fileName},
+			{"sourceFolder", r.Match.SourceFolder, &r.sourceFolder},
+			{"cameraMake", r.Match.CameraMake, &r.cameraMake},
+			{"cameraModel", r.Match.CameraModel, &r.cameraModel},
+			{"lens", r.Match.Lens, &r.lens},
+			{"software", r.Match.Software, &r.software},
+			{"site", r.Match.Site, &r.site},
+		} {
+			if c.expr == "" {
+				continue
+			}
+			*c.re, err = regexp.Compile("(?i)" + c.expr)
+			if err != nil {
+				return rs, fmt.Errorf("%s has an invalid %s: %w", r.Name, c.field, err)
+			}
+		}
+
+		extensions := make([]string, len(r.Match.Extensions))
+		for j, ext := range r.Match.Extensions {
+			extensions[j] = strings.ToLower(strings.TrimPrefix(ext, "."))
+		}
+		r.Match.Extensions = extensions
+		compiled.Rules = append(compiled.Rules, r)
+	}
+	return compiled, nil
+}
+
+// Check is the result of checking a single rule against a file, with the reason it didn't match
+type Check struct {
+	Rule     string
+	Category string
+	Matched  bool
+	Reason   string
+}
+
+// Classify returns the category of the first matching rule and the rule's name,
+// or the default category and an empty name
+func (rs RuleSet) Classify(s Subject) (string, string) {
+	for _, r := range rs.Rules {
+		if ok, _ := r.check(s); ok {
+			return r.Category, r.Name
+		}
+	}
+	return rs.Default, ""
+}
+
+// Explain checks the rules in the same way as Classify, returning every rule checked up to
+// and including the one that matched
+func (rs RuleSet) Explain(s Subject) (string, []Check) {
+	var checks []Check
+	for _, r := range rs.Rules {
+		ok, reason := r.check(s)
+		checks = append(checks, Check{
+			Rule:     r.Name,
+			Category: r.Category,
+			Matched:  ok,
+			Reason:   reason,
+		})
+		if ok {
+			return r.Category, checks
+		}
+	}
+	return rs.Default, checks
+}
+
+// check returns whether the rule matches, and if not the first condition that failed
+func (r Rule) check(s Subject) (bool, string) {
+	switch {
+	case len(r.Match.Extensions) > 0 && !genutils.InArray(r.Match.Extensions, strings.ToLower(s.Extension)):
+		return false, fmt.Sprintf("extension %q is not one of %v", s.Extension, r.Match.Extensions)
+	case r.Match.Raw != nil && *r.Match.Raw != s.IsRaw:
+		return false, fmt.Sprintf("raw is %t", s.IsRaw)
+	case !matchesRegex(r.fileName, s.FileName):
+		return false, regexReason("fileName", s.FileName, r.fileName)
+	case !matchesRegex(r.sourceFolder, s.SourceFolder):
+		return false, regexReason("sourceFolder", s.SourceFolder, r.sourceFolder)
+	case !matchesRegex(r.cameraMake, s.CameraMake):
+		return false, regexReason("cameraMake", s.CameraMake, r.cameraMake)
+	case !matchesRegex(r.cameraModel, s.CameraModel):
+		return false, regexReason("cameraModel", s.CameraModel, r.cameraModel)
+	case !matchesRegex(r.lens, s.Lens):
+		return false, regexReason("lens", s.Lens, r.lens)
+	case !matchesRegex(r.software, s.Software):
+		return false, regexReason("software", s.Software, r.software)
+	case !matchesRegex(r.site, s.Site):
+		return false, regexReason("site", s.Site, r.site)
+	case r.Match.HasCamera != nil && *r.Match.HasCamera != s.hasCamera():
+		return false, fmt.Sprintf("has camera is %t", s.hasCamera())
+	case r.Match.ScreenSize != nil && *r.Match.ScreenSize != isScreenSize(s.Width, s.Height):
+		return false, fmt.Sprintf("screen size is %t for %dx%d", isScreenSize(s.Width, s.Height), s.Width, s.Height)
+	case r.Match.MinWidth > 0 && s.Width < r.Match.MinWidth:
+		return false, fmt.Sprintf("width %d is less than %d", s.Width, r.Match.MinWidth)
+	case r.Match.MaxWidth > 0 && s.Width > r.Match.MaxWidth:
+		return false, fmt.Sprintf("width %d is more than %d", s.Width, r.Match.MaxWidth)
+	case r.Match.MinHeight > 0 && s.Height < r.Match.MinHeight:
+		return false, fmt.Sprintf("height %d is less than %d", s.Height, r.Match.MinHeight)
+	case r.Match.MaxHeight > 0 && s.Height > r.Match.MaxHeight:
+		return false, fmt.Sprintf("height %d is more than %d", s.Height, r.Match.MaxHeight)
+	}
+	return true, ""
+}
+
+func matchesRegex(re *regexp.Regexp, s string) bool {
+	return re == nil || re.MatchString(s)
+}
+
+func regexReason(field, value string, re *regexp.Regexp) string {
+	return fmt.Sprintf("%s %q does not match %q", field, value, strings.TrimPrefix(re.String(), "(?i)"))
+}
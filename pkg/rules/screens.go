@@ -0,0 +1,31 @@
+package rules
+
+// screenSizes being the resolutions of common phone, tablet and computer screens, as width by height
+// in landscape, so a screenshot in either orientation matches
+var screenSizes = [][2]int{
+	// computers
+	{1280, 720}, {1280, 800}, {1366, 768}, {1440, 900}, {1536, 864}, {1600, 900}, {1680, 1050},
+	{1920, 1080}, {1920, 1200}, {2560, 1080}, {2560, 1440}, {2560, 1600}, {2560, 1664}, {2880, 1800},
+	{2940, 1912}, {3024, 1964}, {3440, 1440}, {3456, 2234}, {3840, 2160}, {5120, 2880},
+	// iphones
+	{1136, 640}, {1334, 750}, {1792, 828}, {2208, 1242}, {2436, 1125}, {2532, 1170}, {2556, 1179},
+	{2622, 1206}, {2688, 1242}, {2778, 1284}, {2796, 1290}, {2868, 1320},
+	// android phones
+	{1600, 720}, {2220, 1080}, {2280, 1080}, {2340, 1080}, {2400, 1080}, {2408, 1080}, {2640, 1080},
+	{2960, 1440}, {3040, 1440}, {3088, 1440}, {3120, 1440}, {3200, 1440},
+	// tablets
+	{2048, 1536}, {2160, 1620}, {2224, 1668}, {2266, 1488}, {2360, 1640}, {2388, 1668}, {2420, 1668},
+	{2732, 2048}, {2752, 2064},
+}
+
+func isScreenSize(width, height int) bool {
+	if width < height {
+		width, height = height, width
+	}
+	for _, size := range screenSizes {
+		if size[0] == width && size[1] == height {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package sequence
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	TypeBurst   = "burst"
+	TypeBracket = "bracket"
+
+	// minBracketLength and maxBracketLength being the number of shots cameras take in an exposure bracket
+	minBracketLength = 3
+	maxBracketLength = 9
+)
+
+// Options being how sequences are found, the zero value finds none.
+// Bursts are at least MinBurstLength shots each within BurstInterval of the last,
+// brackets are shots with different exposure bias each within BracketInterval of the last.
+type Options struct {
+	BurstInterval   time.Duration
+	MinBurstLength  int
+	BracketInterval time.Duration
+}
+
+func (o Options) Enabled() bool {
+	return o.BurstInterval > 0
+}
+
+// Shot being a single photo, ExposureBias is in EV and AutoBracket is set when the camera
+// recorded it as part of an auto exposure bracket
+type Shot struct {
+	ID           string
+	Time         time.Time
+	ExposureBias float64
+	AutoBracket  bool
+}
+
+type Sequence struct {
+	Type  string
+	Shots []Shot
+}
+
+// Summary describes the sequence, such as "12 shots over 1.4s" or "5 shots from -2.0 to +2.0 EV"
+func (s Sequence) Summary() string {
+	first, last := s.Shots[0], s.Shots[len(s.Shots)-1]
+	if s.Type == TypeBracket {
+		low, high := first.ExposureBias, first.ExposureBias
+		for _, shot := range s.Shots {
+			low = min(low, shot.ExposureBias)
+			high = max(high, shot.ExposureBias)
+		}
+		return fmt.Sprintf("%d shots from %+.1f to %+.1f EV", len(s.Shots), low, high)
+	}
+	return fmt.Sprintf("%d shots over %s", len(s.Shots), last.Time.Sub(first.Time))
+}
+
+// Find finds the bursts and brackets in shots from the same camera, brackets are checked first
+// so a bracket taken in continuous shooting isn't treated as a burst
+func Find(shots []Shot, opts Options) []Sequence {
+	if !opts.Enabled() || len(shots) == 0 {
+		return nil
+	}
+
+	shots = append([]Shot{}, shots...)
+	sort.Slice(shots, func(i, j int) bool {
+		if shots[i].Time.Equal(shots[j].Time) {
+			return shots[i].ID < shots[j].ID
+		}
+		return shots[i].Time.Before(shots[j].Time)
+	})
+
+	var sequences []Sequence
+	for i := 0; i < len(shots); {
+		if shots[i].Time.IsZero() {
+			i++
+			continue
+		}
+
+		if end := bracketEnd(shots, i, opts.BracketInterval); end-i >= minBracketLength {
+			sequences = append(sequences, Sequence{Type: TypeBracket, Shots: shots[i:end]})
+			i = end
+			continue
+		}
+
+		end := i + 1
+		for end < len(shots) && shots[end].Time.Sub(shots[end-1].Time) <= opts.BurstInterval {
+			end++
+		}
+		if end-i >= opts.MinBurstLength {
+			sequences = append(sequences, Sequence{Type: TypeBurst, Shots: shots[i:end]})
+			i = end
+			continue
+		}
+		i++
+	}
+	return sequences
+}
+
+// bracketEnd finds where a bracket starting at shot i ends, the bracket stops at a repeated
+// exposure bias as that is the start of the next one
+func bracketEnd(shots []Shot, i int, interval time.Duration) int {
+	biases := map[float64]bool{shots[i].ExposureBias: true}
+	autoBracket := shots[i].AutoBracket
+	end := i + 1
+	for end < len(shots) && end-i < maxBracketLength {
+		shot := shots[end]
+		if shot.Time.Sub(shots[end-1].Time) > interval || shot.AutoBracket != autoBracket || biases[shot.ExposureBias] {
+			break
+		}
+		biases[shot.ExposureBias] = true
+		end++
+	}
+	return end
+}
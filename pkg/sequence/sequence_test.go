@@ -0,0 +1,115 @@
+package sequence
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFind(t *testing.T) {
+	start := time.Date(2021, 6, 5, 14, 30, 15, 0, time.UTC)
+	opts := Options{BurstInterval: 500 * time.Millisecond, MinBurstLength: 5, BracketInterval: time.Second}
+	// shots taken the offsets apart, with the exposure biases if given
+	shots := func(offsets []time.Duration, biases []float64, autoBracket bool) []Shot {
+		var s []Shot
+		for i, offset := range offsets {
+			shot := Shot{ID: fmt.Sprintf("IMG_%d", i), Time: start.Add(offset), AutoBracket: autoBracket}
+			if biases != nil {
+				shot.ExposureBias = biases[i]
+			}
+			s = append(s, shot)
+		}
+		return s
+	}
+	ms := func(offsets ...int) []time.Duration {
+		var d []time.Duration
+		for _, o := range offsets {
+			d = append(d, time.Duration(o)*time.Millisecond)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name  string
+		shots []Shot
+		opts  Options
+		// want being the type and summary of each sequence found, in order
+		want []string
+	}{
+		{
+			name:  "burst within the interval",
+			shots: shots(ms(0, 200, 400, 600, 800), nil, false),
+			opts:  opts,
+			want:  []string{"burst: 5 shots over 800ms"},
+		},
+		{
+			name:  "burst broken by a longer gap",
+			shots: shots(ms(0, 200, 400, 1000, 1200, 1400), nil, false),
+			opts:  opts,
+		},
+		{
+			name:  "burst continues up to the interval",
+			shots: shots(ms(0, 500, 1000, 1500, 2000, 2501), nil, false),
+			opts:  opts,
+			want:  []string{"burst: 5 shots over 2s"},
+		},
+		{
+			name:  "too short for a burst",
+			shots: shots(ms(0, 100, 200, 300), nil, false),
+			opts:  opts,
+		},
+		{
+			name:  "bracket by exposure bias",
+			shots: shots(ms(0, 300, 600), []float64{0, -2, 2}, false),
+			opts:  opts,
+			want:  []string{"bracket: 3 shots from -2.0 to +2.0 EV"},
+		},
+		{
+			name:  "repeated exposure bias starts the next bracket",
+			shots: shots(ms(0, 300, 600, 900, 1200, 1500), []float64{0, -1, 1, 0, -1, 1}, true),
+			opts:  opts,
+			want:  []string{"bracket: 3 shots from -1.0 to +1.0 EV", "bracket: 3 shots from -1.0 to +1.0 EV"},
+		},
+		{
+			name: "auto bracket shots aren't grouped with manual ones",
+			shots: append(shots(ms(0, 300), []float64{0, -1}, true),
+				Shot{ID: "IMG_2", Time: start.Add(600 * time.Millisecond), ExposureBias: 1}),
+			opts: opts,
+		},
+		{
+			name:  "bracket broken by the bracket interval",
+			shots: shots(ms(0, 300, 1400), []float64{0, -1, 1}, true),
+			opts:  opts,
+		},
+		{
+			name: "bracket shot in continuous shooting isn't a burst",
+			shots: shots(ms(0, 100, 200, 300, 400, 500, 600),
+				[]float64{0, -1, 1, 0, 0, 0, 0}, false),
+			opts: Options{BurstInterval: 500 * time.Millisecond, MinBurstLength: 4, BracketInterval: time.Second},
+			want: []string{"bracket: 3 shots from -1.0 to +1.0 EV", "burst: 4 shots over 300ms"},
+		},
+		{
+			name:  "shots without a time are left out",
+			shots: append(shots(ms(0, 100, 200, 300, 400), nil, false), Shot{ID: "IMG_5"}),
+			opts:  opts,
+			want:  []string{"burst: 5 shots over 400ms"},
+		},
+		{
+			name:  "disabled",
+			shots: shots(ms(0, 100, 200, 300, 400), nil, false),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range Find(tt.shots, tt.opts) {
+				got = append(got, s.Type+": "+s.Summary())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
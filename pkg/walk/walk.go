@@ -0,0 +1,52 @@
+package walk
+
+import (
+	"strings"
+
+	"github.com/photos-sorter/pkg/genutils"
+)
+
+// SystemFolders being the folders windows, macs and linux keep at the root of drives, which never hold photos
+var SystemFolders = []string{
+	"System Volume Information", "$RECYCLE.BIN", "lost+found",
+	".Spotlight-V100", ".fseventsd", ".Trashes", ".TemporaryItems", ".DocumentRevisions-V100",
+}
+
+// Options being how the source path is walked, the zero value walks every folder and file without
+// following symlinks, skipping any folder that can't be read
+type Options struct {
+	// FollowSymlinks walks the folders and reads the files symlinks point to, each folder is only walked
+	// once so symlinks that loop back to a parent folder are skipped
+	FollowSymlinks bool
+	// SkipHidden skips folders and files whose name starts with a "."
+	SkipHidden bool
+	// SkipSystem skips the system folders, such as "System Volume Information"
+	SkipSystem bool
+	// MaxDepth being how many levels of folders are walked, 1 being only the source path, 0 for no limit
+	MaxDepth int
+	// StopOnError stops the walk at the first folder that can't be read, such as one without permission
+	StopOnError bool
+}
+
+// SkipDir gets why a folder at the depth, the source path's subfolders being at depth 1, isn't walked
+func (o Options) SkipDir(name string, depth int) (string, bool) {
+	switch {
+	case o.SkipSystem && genutils.InArray(SystemFolders, name):
+		return "system folder", true
+	case o.SkipHidden && IsHidden(name):
+		return "hidden folder", true
+	case o.MaxDepth > 0 && depth >= o.MaxDepth:
+		return "deeper than the max depth", true
+	}
+	return "", false
+}
+
+// SkipFile gets whether a file isn't read
+func (o Options) SkipFile(name string) bool {
+	return o.SkipHidden && IsHidden(name)
+}
+
+// IsHidden being unix hidden files and folders, whose name starts with a "."
+func IsHidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
@@ -0,0 +1,123 @@
+package sorting
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"github.com/photos-sorter/image_manager"
+	"github.com/photos-sorter/pkg/duplicate"
+	"github.com/photos-sorter/pkg/report"
+)
+
+const (
+	duplicatesFolder = "duplicates"
+
+	groupTypeDuplicate = "duplicate"
+
+	roleKept      = "kept"
+	roleDuplicate = "duplicate"
+)
+
+// findDuplicates sends all but the best copy of each near-duplicate image into the duplicates folder, keeping
+// the folders they would have been sorted into. Raws, files grouped with a raw and sequence shots are left out,
+// as they are meant to look alike.
+func findDuplicates(ctx context.Context, logger *zap.Logger, opts duplicate.Options, workers int,
+	destinationPath string, files map[string]image_manager.ImageData, groups map[string]*fileGroup,
+	sequences []report.Group,
+) (map[string]image_manager.ImageData, []report.Group, error) {
+	if !opts.Enabled() {
+		return files, nil, nil
+	}
+
+	related := make(map[string]bool)
+	for _, group := range groups {
+		related[group.parent] = true
+		for _, path := range append(append([]string{}, group.pairs...), group.edits...) {
+			related[path] = true
+		}
+	}
+	for _, g := range sequences {
+		related[g.Parent.Source] = true
+		for _, m := range g.Members {
+			related[m.Source] = true
+		}
+	}
+
+	var paths []string
+	for path, f := range files {
+		if related[path] || image_manager.IsRawType(filepath.Ext(f.GetFilePath())) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	items := make([]*duplicate.Item, len(paths))
+	err := inParallel(ctx, workers, len(paths), func(i int) {
+		items[i] = duplicateItem(logger, opts, files[paths[i]])
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("stopped finding duplicates: %w", err)
+	}
+
+	hashed := make([]duplicate.Item, 0, len(items))
+	for _, item := range items {
+		if item != nil {
+			hashed = append(hashed, *item)
+		}
+	}
+
+	var reportGroups []report.Group
+	for _, d := range duplicate.Find(hashed, opts) {
+		kept := files[d.Keep.ID]
+		g := report.Group{
+			Type:    groupTypeDuplicate,
+			Summary: d.Summary(),
+			Parent:  report.File{Role: roleKept, Source: d.Keep.ID, Destination: destinationPath + "/" + kept.DestPath},
+		}
+		for _, item := range d.Duplicates {
+			f := files[item.ID]
+			f.DestPath = filepath.Join(duplicatesFolder, f.DestPath)
+			files[item.ID] = f
+			g.Members = append(g.Members, report.File{Role: roleDuplicate, Source: item.ID,
+				Destination: destinationPath + "/" + f.DestPath})
+		}
+		logger.Debug("found duplicates",
+			zap.String("kept", d.Keep.ID),
+			zap.String("summary", g.Summary))
+		reportGroups = append(reportGroups, g)
+	}
+	logger.Info("Found duplicates",
+		zap.Int("hashed", len(hashed)),
+		zap.Int("groups", len(reportGroups)))
+	return files, reportGroups, nil
+}
+
+// duplicateItem hashes the image, images that can't be decoded such as heic without a preview are left out
+func duplicateItem(logger *zap.Logger, opts duplicate.Options, f image_manager.ImageData) *duplicate.Item {
+	hash, err := image_manager.GetPerceptualHash(f, opts.Algorithm)
+	if err != nil {
+		logger.Debug("failed to hash image, not checking it for duplicates",
+			zap.String("file", f.GetFilePath()),
+			zap.Error(err))
+		return nil
+	}
+
+	item := &duplicate.Item{
+		ID:        f.GetFilePath(),
+		Hash:      hash.Value,
+		Time:      image_manager.GetTimestamp(f),
+		Width:     hash.Width,
+		Height:    hash.Height,
+		HasCamera: f.GetCameraModel() != "",
+	}
+	if info, err := os.Stat(f.GetFilePath()); err == nil {
+		item.Size = info.Size()
+	}
+	return item
+}
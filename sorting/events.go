@@ -0,0 +1,56 @@
+package sorting
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/photos-sorter/pkg/event"
+	"github.com/photos-sorter/pkg/metadata"
+)
+
+// findEvents groups the files into events by when, and optionally where, they were taken, matching
+// them to the events stored in the destination so labels and folders carry across runs
+func findEvents[T any](logger *zap.Logger, opts event.Options, destinationPath string, files map[string]T,
+	toItem func(string, T) event.Item, withEvent func(T, string) T,
+) (map[string]T, error) {
+	if !opts.Enabled() {
+		return files, nil
+	}
+
+	store, err := event.ReadStore(destinationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]event.Item, 0, len(files))
+	for path, f := range files {
+		items = append(items, toItem(path, f))
+	}
+	events := store.Merge(event.Find(items, opts), opts)
+	for _, e := range events {
+		for _, id := range e.IDs {
+			files[id] = withEvent(files[id], e.Name())
+		}
+		logger.Debug("found event",
+			zap.String("name", e.Name()),
+			zap.Int("files", len(e.IDs)))
+	}
+
+	err = store.Write()
+	if err != nil {
+		return nil, fmt.Errorf("failed to store events: %w", err)
+	}
+	logger.Info("Grouped files into events", zap.Int("events", len(events)), zap.Int("stored", len(store.Events)))
+	return files, nil
+}
+
+// eventItem makes the event item for a file, with its location when it has gps coordinates
+func eventItem(path string, t time.Time, location metadata.Location, hasLocation bool) event.Item {
+	item := event.Item{ID: path, Time: t}
+	if hasLocation {
+		item.Location = &location
+	}
+	return item
+}
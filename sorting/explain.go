@@ -0,0 +1,382 @@
+package sorting
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/photos-sorter/image_manager"
+	"github.com/photos-sorter/pkg/config"
+	"github.com/photos-sorter/pkg/event"
+	"github.com/photos-sorter/pkg/genutils"
+	"github.com/photos-sorter/pkg/geocode"
+	"github.com/photos-sorter/pkg/metadata"
+	"github.com/photos-sorter/pkg/pathtemplate"
+	"github.com/photos-sorter/pkg/quality"
+	"github.com/photos-sorter/pkg/rules"
+	"github.com/photos-sorter/video_manager"
+)
+
+// ExplainFile runs the metadata extraction, classification and path logic on a single file,
+// writing out each rule checked and where the file would be sorted to
+func ExplainFile(logger *zap.Logger, cfg config.Config, path string, w io.Writer) error {
+	extractor := newMetadataExtractor(logger, cfg)
+	defer extractor.Close()
+
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	switch {
+	case genutils.InArray(image_manager.GetImageTypes(), ext):
+		return explainImage(logger, cfg, extractor, path, w)
+	case genutils.InArray(video_manager.GetVideoTypes(), ext):
+		return explainVideo(logger, cfg, extractor, path, w)
+	default:
+		return fmt.Errorf("%s is not a recognised image or video file type", path)
+	}
+}
+
+func explainImage(logger *zap.Logger, cfg config.Config, extractor *metadata.Registry, path string, w io.Writer) error {
+	i, err := image_manager.GetPhoto(logger, extractor, path)
+	if err != nil {
+		return fmt.Errorf("failed to get image data: %w", err)
+	}
+	i = image_manager.CorrectTimestamp(logger, i, cfg.ClockOffsets)
+	i = image_manager.AddPlace(logger, i, cfg.Geocoder)
+	i = image_manager.AddSite(logger, i, cfg.Sites)
+	if cfg.Events.Enabled() {
+		name, err := lookupEvent(cfg, image_manager.GetTimestamp(i))
+		if err != nil {
+			return err
+		}
+		i = image_manager.WithEvent(i, name)
+	}
+
+	location, hasLocation := i.GetLocation()
+	subject := imageRulesSubject(i)
+	category, checks := cfg.ImageRules().Explain(subject)
+
+	hash, err := fileHash(cfg.ImageNameTemplate(), path)
+	if err != nil {
+		return err
+	}
+	values := renameFile(cfg.ImageNameTemplate(), map[string]int{path: 1}, map[string]string{path: hash}, path,
+		imagePathValues(category, i))
+	template := cfg.ImagePathTemplates().For(category)
+	destPath := template.Execute(values)
+
+	var qualityScores string
+	if cfg.Quality.Enabled() {
+		var rejected bool
+		qualityScores, rejected = describeQuality(cfg.Quality, i)
+		if rejected && cfg.Quality.MoveRejects {
+			destPath = filepath.Join(rejectsFolder, destPath)
+		}
+	}
+
+	writeExplanation(w, explanation{
+		path:            path,
+		fileType:        "image",
+		subject:         subject,
+		timestamp:       image_manager.GetTimestamp(i).String(),
+		timestampSource: i.GetTimestampSource(),
+		cameraSerial:    i.GetCameraSerial(),
+		location:        describeLocation(location, hasLocation, i.GetPlace()),
+		quality:         qualityScores,
+		checks:          checks,
+		category:        category,
+		nameTemplate:    cfg.ImageNameTemplate(),
+		pathTemplate:    template,
+		destPath:        destPath,
+		destinationRoot: cfg.DestinationPath,
+		notApplied:      notApplied(cfg, true),
+		pairing:         explainStillPairing(logger, cfg, extractor, i, destPath),
+	})
+	return nil
+}
+
+func explainVideo(logger *zap.Logger, cfg config.Config, extractor *metadata.Registry, path string, w io.Writer) error {
+	v, err := video_manager.GetVideo(logger, extractor, path)
+	if err != nil {
+		return fmt.Errorf("failed to get video data: %w", err)
+	}
+	v = video_manager.CorrectTimestamp(logger, v, cfg.ClockOffsets)
+	v = video_manager.AddPlace(logger, v, cfg.Geocoder)
+	v = video_manager.AddSite(logger, v, cfg.Sites)
+	if cfg.Events.Enabled() {
+		name, err := lookupEvent(cfg, video_manager.GetTimestamp(v))
+		if err != nil {
+			return err
+		}
+		v = video_manager.WithEvent(v, name)
+	}
+
+	location, hasLocation := v.GetLocation()
+	subject := videoRulesSubject(v)
+	category, checks := cfg.VideoRules().Explain(subject)
+
+	hash, err := fileHash(cfg.VideoNameTemplate(), path)
+	if err != nil {
+		return err
+	}
+	values := renameFile(cfg.VideoNameTemplate(), map[string]int{path: 1}, map[string]string{path: hash}, path,
+		videoPathValues(category, v))
+	template := cfg.VideoPathTemplates().For(category)
+
+	pairing, err := explainClipPairing(logger, cfg, extractor, v)
+	if err != nil {
+		return err
+	}
+	writeExplanation(w, explanation{
+		path:            path,
+		fileType:        "video",
+		subject:         subject,
+		timestamp:       video_manager.GetTimestamp(v).String(),
+		timestampSource: v.GetTimestampSource(),
+		cameraSerial:    v.GetCameraSerial(),
+		location:        describeLocation(location, hasLocation, v.GetPlace()),
+		checks:          checks,
+		category:        category,
+		nameTemplate:    cfg.VideoNameTemplate(),
+		pathTemplate:    template,
+		destPath:        template.Execute(values),
+		destinationRoot: cfg.DestinationPath,
+		notApplied:      notApplied(cfg, false),
+		pairing:         pairing,
+	})
+	return nil
+}
+
+type explanation struct {
+	path            string
+	fileType        string
+	subject         rules.Subject
+	timestamp       string
+	timestampSource string
+	cameraSerial    string
+	location        string
+	quality         string
+	checks          []rules.Check
+	category        string
+	nameTemplate    pathtemplate.Template
+	pathTemplate    pathtemplate.Template
+	destPath        string
+	destinationRoot string
+	notApplied      []string
+	pairing         []string
+}
+
+func writeExplanation(w io.Writer, e explanation) {
+	fmt.Fprintf(w, "File:          %s (%s)\n", e.path, e.fileType)
+	fmt.Fprintf(w, "Camera:        make %q, model %q\n", e.subject.CameraMake, e.subject.CameraModel)
+	if e.cameraSerial != "" {
+		fmt.Fprintf(w, "Serial number: %s\n", e.cameraSerial)
+	}
+	fmt.Fprintf(w, "Lens:          %q\n", e.subject.Lens)
+	fmt.Fprintf(w, "Software:      %q\n", e.subject.Software)
+	fmt.Fprintf(w, "Dimensions:    %dx%d\n", e.subject.Width, e.subject.Height)
+	fmt.Fprintf(w, "Timestamp:     %s (from %s)\n", e.timestamp, e.timestampSource)
+	fmt.Fprintf(w, "Location:      %s\n", e.location)
+	if e.subject.Site != "" {
+		fmt.Fprintf(w, "Site:          %s\n", e.subject.Site)
+	}
+	if e.quality != "" {
+		fmt.Fprintf(w, "Quality:       %s\n", e.quality)
+	}
+
+	fmt.Fprintln(w, "Rules checked:")
+	var matched bool
+	for _, c := range e.checks {
+		if c.Matched {
+			matched = true
+			fmt.Fprintf(w, "  [match]    %s -> %s\n", c.Rule, c.Category)
+			continue
+		}
+		fmt.Fprintf(w, "  [no match] %s -> %s: %s\n", c.Rule, c.Category, c.Reason)
+	}
+	if !matched {
+		fmt.Fprintf(w, "  no rules matched, using the default category\n")
+	}
+
+	fmt.Fprintf(w, "Category:      %s\n", e.category)
+	fmt.Fprintf(w, "Name template: %s\n", e.nameTemplate)
+	fmt.Fprintf(w, "Path template: %s\n", e.pathTemplate)
+	root := explainedRoot(e.destinationRoot)
+	if len(e.notApplied) == 0 {
+		fmt.Fprintf(w, "Destination:   %s/%s\n", root, e.destPath)
+	} else {
+		fmt.Fprintf(w, "Destination:   %s/%s (before grouping)\n", root, e.destPath)
+	}
+	for _, p := range e.pairing {
+		fmt.Fprintln(w, p)
+	}
+	if len(e.notApplied) > 0 {
+		fmt.Fprintf(w, "Not applied:   %s, which need the other files being sorted and can change the destination\n",
+			strings.Join(e.notApplied, ", "))
+	}
+}
+
+// explainedRoot being the destination shown in explanations, which can be explained without one
+func explainedRoot(destinationPath string) string {
+	if destinationPath == "" {
+		return "<destination>"
+	}
+	return destinationPath
+}
+
+// explainStillPairing runs the same live photo and motion photo checks as the image sort on the still,
+// looking for its live photo video next to it
+func explainStillPairing(logger *zap.Logger, cfg config.Config, extractor *metadata.Registry,
+	i image_manager.ImageData, destPath string,
+) []string {
+	var pairing []string
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(i.GetFileName()), "."))
+	if genutils.InArray(image_manager.GetLivePhotoStillTypes(), ext) {
+		clips := filesWithSameStem(i.GetFilePath(), livePhotoClipTypes)
+		clip, ok := findLivePhotoClips(context.Background(), logger, cfg, extractor,
+			map[string]image_manager.ImageData{i.GetFilePath(): i}, clips)[i.GetFilePath()]
+		switch {
+		case ok:
+			pairing = append(pairing, fmt.Sprintf("Live photo:    video %s goes to %s/%s", clip,
+				explainedRoot(cfg.DestinationPath), companionDestPath(destPath, filepath.Ext(clip))))
+		case len(clips) > 0:
+			pairing = append(pairing, fmt.Sprintf("Live photo:    %s has the same name but isn't the same live photo",
+				strings.Join(clips, ", ")))
+		default:
+			pairing = append(pairing, "Live photo:    no video with the same name")
+		}
+	}
+
+	video, ok := findMotionPhoto(logger, i)
+	switch {
+	case !ok:
+		pairing = append(pairing, "Motion photo:  no embedded video")
+	case cfg.ExtractMotionPhotoVideo:
+		pairing = append(pairing, fmt.Sprintf("Motion photo:  %d byte embedded video is extracted to %s/%s",
+			video.Length, explainedRoot(cfg.DestinationPath), companionDestPath(destPath, ".mp4")))
+	default:
+		pairing = append(pairing, fmt.Sprintf("Motion photo:  %d byte embedded video, not extracted", video.Length))
+	}
+	return pairing
+}
+
+// explainClipPairing checks whether the video is the clip of a live photo as the video sort does,
+// reading and filtering the stills with the same name next to it
+func explainClipPairing(logger *zap.Logger, cfg config.Config, extractor *metadata.Registry,
+	v video_manager.VideoData,
+) ([]string, error) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(v.GetFileName()), "."))
+	if !genutils.InArray(livePhotoClipTypes, ext) {
+		return nil, nil
+	}
+	stillPaths := filesWithSameStem(v.GetFilePath(), image_manager.GetLivePhotoStillTypes())
+	if len(stillPaths) == 0 {
+		return []string{"Live photo:    no still with the same name"}, nil
+	}
+
+	stills := make(map[string]image_manager.ImageData)
+	for _, path := range stillPaths {
+		still, err := image_manager.GetPhoto(logger, extractor, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get live photo still data: %w", err)
+		}
+		still = image_manager.CorrectTimestamp(logger, still, cfg.ClockOffsets)
+		if reason, filtered := cfg.Filter.CheckMetadata(image_manager.GetTimestamp(still), still.GetCameraModel()); filtered {
+			return []string{fmt.Sprintf("Live photo:    still %s is filtered out (%s), the video is sorted on its own",
+				path, reason)}, nil
+		}
+		stills[path] = still
+	}
+
+	for still, clip := range findLivePhotoClips(context.Background(), logger, cfg, extractor, stills,
+		[]string{v.GetFilePath()}) {
+		if clip == v.GetFilePath() {
+			return []string{fmt.Sprintf("Live photo:    video of %s, it is sorted with its still and not on its own",
+				still)}, nil
+		}
+	}
+	return []string{fmt.Sprintf("Live photo:    %s has the same name but isn't the same live photo",
+		strings.Join(stillPaths, ", "))}, nil
+}
+
+// filesWithSameStem finds the files of the given types next to the path sharing its name, as live photo
+// pairing matches them
+func filesWithSameStem(path string, types []string) []string {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, entry := range entries {
+		other := filepath.Join(filepath.Dir(path), entry.Name())
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(entry.Name()), "."))
+		if entry.IsDir() || other == path || !genutils.InArray(types, ext) || stemKey(other) != stemKey(path) {
+			continue
+		}
+		paths = append(paths, other)
+	}
+	return paths
+}
+
+// lookupEvent gets the name of the event the file would join from the events stored in the destination,
+// without storing anything, or the event of its own it would start when there is no destination
+func lookupEvent(cfg config.Config, t time.Time) (string, error) {
+	if t.IsZero() {
+		return "", nil
+	}
+	if cfg.DestinationPath == "" {
+		return event.Event{Start: t, End: t}.Name(), nil
+	}
+	store, err := event.ReadStore(cfg.DestinationPath)
+	if err != nil {
+		return "", err
+	}
+	return store.Lookup(t, cfg.Events.Gap).Name(), nil
+}
+
+// notApplied lists the passes that group files together, which explaining a single file can't run
+func notApplied(cfg config.Config, isImage bool) []string {
+	if !isImage {
+		return nil
+	}
+	passes := []string{"raw+jpeg pairs and sidecars"}
+	if cfg.Sequences.Enabled() {
+		passes = append(passes, "sequences")
+	}
+	if cfg.Duplicates.Enabled() {
+		passes = append(passes, "duplicates")
+	}
+	return passes
+}
+
+// describeLocation gives the gps coordinates along with the nearest known place
+func describeLocation(location metadata.Location, ok bool, place geocode.Place) string {
+	if !ok {
+		return "none"
+	}
+	coordinates := fmt.Sprintf("%.6f, %.6f", location.Latitude, location.Longitude)
+	if place.Name == "" && place.Country != "" {
+		return fmt.Sprintf("%s (no known place nearby, in %s)", coordinates, place.Country)
+	}
+	if place.Name == "" {
+		return coordinates + " (no known place nearby)"
+	}
+	return fmt.Sprintf("%s (%s, %s, %s)", coordinates, place.Name, place.Region, place.Country)
+}
+
+// describeQuality gives the image's sharpness and exposure scores, and why it is a reject if it is one
+func describeQuality(opts quality.Options, i image_manager.ImageData) (string, bool) {
+	scores, err := image_manager.GetQualityScores(i)
+	if err != nil {
+		return fmt.Sprintf("not scored: %s", err), false
+	}
+	reason, rejected := opts.Reject(scores)
+	if !rejected {
+		return scores.String(), false
+	}
+	return fmt.Sprintf("%s, rejected as %s", scores, reason), true
+}
@@ -0,0 +1,80 @@
+package sorting
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/photos-sorter/file_manager"
+	"github.com/photos-sorter/pkg/filter"
+	"github.com/photos-sorter/pkg/report"
+)
+
+// skipFiltered leaves out the folders and files the filter excludes while the source path is searched, adding
+// them to the report when one is given. Only the path is checked when checkFile is false, such as for sidecars
+// which follow their image rather than being filtered by their own extension or size.
+func skipFiltered(logger *zap.Logger, f filter.Filter, sourcePath string, runReport *report.Report, checkFile bool,
+) func(string, os.DirEntry) bool {
+	return func(path string, e os.DirEntry) bool {
+		relPath, err := filepath.Rel(sourcePath, path)
+		if err != nil {
+			relPath = path
+		}
+
+		var reason string
+		var filtered bool
+		switch {
+		case e.IsDir():
+			reason, filtered = f.CheckDir(relPath)
+		case !checkFile:
+			reason, filtered = f.CheckPath(relPath)
+		default:
+			var size int64
+			if info, err := e.Info(); err == nil {
+				size = info.Size()
+			}
+			reason, filtered = f.CheckFile(relPath, size)
+		}
+		if !filtered {
+			return false
+		}
+
+		logger.Debug("filtered out",
+			zap.String("path", path),
+			zap.String("reason", reason))
+		if runReport != nil {
+			runReport.AddFiltered(path, reason)
+			if !e.IsDir() {
+				file_manager.Progress.Skipped()
+			}
+		}
+		return true
+	}
+}
+
+// filterByMetadata leaves out the files the filter excludes by when they were taken or their camera,
+// once their metadata has been read and any clock offset applied
+func filterByMetadata[T any](logger *zap.Logger, f filter.Filter, files map[string]T,
+	getTimestamp func(T) time.Time, getCameraModel func(T) string, runReport *report.Report,
+) map[string]T {
+	var filteredCount int
+	for path, file := range files {
+		reason, filtered := f.CheckMetadata(getTimestamp(file), getCameraModel(file))
+		if !filtered {
+			continue
+		}
+		logger.Debug("filtered out",
+			zap.String("path", path),
+			zap.String("reason", reason))
+		runReport.AddFiltered(path, reason)
+		file_manager.Progress.Skipped()
+		delete(files, path)
+		filteredCount++
+	}
+	if filteredCount > 0 {
+		logger.Info("Filtered files by metadata", zap.Int("count", filteredCount))
+	}
+	return files
+}
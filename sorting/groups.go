@@ -0,0 +1,234 @@
+package sorting
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap"
+
+	"github.com/photos-sorter/image_manager"
+	"github.com/photos-sorter/pkg/report"
+)
+
+const (
+	groupTypeRelated = "related"
+
+	roleRaw     = "raw"
+	rolePair    = "pair"
+	roleSidecar = "sidecar"
+	roleEdit    = "edit"
+)
+
+// fileGroup being files in the same folder with the same stem, the parent is the raw if there is one,
+// pairs were taken at the same time as the parent and are sorted into its folder, sidecars are
+// moved with the file they belong to, and edits are only recorded so they can be traced back to the raw
+type fileGroup struct {
+	parent   string
+	pairs    []string
+	sidecars []sidecarFile
+	edits    []string
+}
+
+// sidecarFile being a sidecar and the source path of the file it belongs to, "IMG_1234.JPG.dop" belongs to
+// "IMG_1234.JPG" and "IMG_1234.xmp" to the parent
+type sidecarFile struct {
+	path  string
+	owner string
+}
+
+// groupRelatedFiles finds the raw+jpeg pairs, sidecars and edits of each file, keyed by the parent's source path
+func groupRelatedFiles(logger *zap.Logger, files map[string]image_manager.ImageData, sidecars []string,
+) map[string]*fileGroup {
+	byStem := make(map[string][]image_manager.ImageData)
+	for _, f := range files {
+		key := stemKey(f.GetFilePath())
+		byStem[key] = append(byStem[key], f)
+	}
+
+	groups := make(map[string]*fileGroup)
+	for key, stemFiles := range byStem {
+		sort.Slice(stemFiles, func(i, j int) bool {
+			return stemFiles[i].GetFilePath() < stemFiles[j].GetFilePath()
+		})
+		parent := stemFiles[0]
+		for _, f := range stemFiles {
+			if image_manager.IsRawType(filepath.Ext(f.GetFilePath())) {
+				parent = f
+				break
+			}
+		}
+		group := &fileGroup{parent: parent.GetFilePath()}
+		groups[key] = group
+
+		if !image_manager.IsRawType(filepath.Ext(parent.GetFilePath())) {
+			continue
+		}
+		for _, f := range stemFiles {
+			if f.GetFilePath() == parent.GetFilePath() {
+				continue
+			}
+			if !image_manager.GetTimestamp(f).Truncate(time.Second).Equal(
+				image_manager.GetTimestamp(parent).Truncate(time.Second)) {
+				logger.Debug("file has the same name as a raw but a different capture time",
+					zap.String("file", f.GetFilePath()),
+					zap.String("raw", parent.GetFilePath()))
+				continue
+			}
+			group.pairs = append(group.pairs, f.GetFilePath())
+		}
+	}
+
+	for _, sidecar := range sidecars {
+		key := stemKey(sidecar)
+		group, ok := groups[key]
+		if !ok {
+			logger.Warn("sidecar has no matching image, leaving it in place",
+				zap.String("sidecar", sidecar))
+			continue
+		}
+		owner, ok := sidecarOwner(sidecar, group.parent, byStem[key])
+		if !ok {
+			logger.Warn("sidecar's image isn't being sorted, leaving it in place",
+				zap.String("sidecar", sidecar))
+			continue
+		}
+		group.sidecars = append(group.sidecars, sidecarFile{path: sidecar, owner: owner})
+	}
+
+	// edits such as "IMG_1234-1e.jpg" or "IMG_1234_DxO.jpg" start with the raw's stem
+	for key, stemFiles := range byStem {
+		group, ok := rawGroupOfEdit(key, groups)
+		if !ok {
+			continue
+		}
+		for _, f := range stemFiles {
+			group.edits = append(group.edits, f.GetFilePath())
+		}
+	}
+
+	parentGroups := make(map[string]*fileGroup)
+	for _, group := range groups {
+		if len(group.pairs) == 0 && len(group.sidecars) == 0 && len(group.edits) == 0 {
+			continue
+		}
+		parentGroups[group.parent] = group
+	}
+	return parentGroups
+}
+
+// keepPairsTogether moves the destination of each pair into its parent's destination folder
+func keepPairsTogether(files map[string]image_manager.ImageData, groups map[string]*fileGroup,
+) map[string]image_manager.ImageData {
+	byPath := make(map[string]string)
+	for name, f := range files {
+		byPath[f.GetFilePath()] = name
+	}
+
+	for _, group := range groups {
+		parent, ok := files[byPath[group.parent]]
+		if !ok {
+			continue
+		}
+		for _, pair := range group.pairs {
+			name := byPath[pair]
+			f := files[name]
+			f.DestPath = filepath.Join(filepath.Dir(parent.DestPath), filepath.Base(f.DestPath))
+			files[name] = f
+		}
+	}
+	return files
+}
+
+// sidecarOwner finds the file a sidecar belongs to, one named with the full image name such as
+// "IMG_1234.JPG.dop" belongs to the file with that name, as DxO and some xmp editors name them, any
+// other belongs to the parent
+func sidecarOwner(sidecar, parent string, stemFiles []image_manager.ImageData) (string, bool) {
+	imageName := strings.TrimSuffix(filepath.Base(sidecar), filepath.Ext(sidecar))
+	if !strings.Contains(imageName, ".") {
+		return parent, true
+	}
+	for _, f := range stemFiles {
+		if strings.EqualFold(filepath.Base(f.GetFilePath()), imageName) {
+			return f.GetFilePath(), true
+		}
+	}
+	return "", false
+}
+
+// sidecarDestPath keeps the sidecar named after the file it belongs to, so "IMG_1234.JPG.dop" follows
+// "IMG_1234.JPG" with its full name and "IMG_1234.xmp" follows the file's stem
+func sidecarDestPath(sidecar, ownerSource, ownerDest string) string {
+	sidecarName := filepath.Base(sidecar)
+	ownerName := filepath.Base(ownerSource)
+	if strings.HasPrefix(strings.ToLower(sidecarName), strings.ToLower(ownerName)+".") {
+		return ownerDest + sidecarName[len(ownerName):]
+	}
+	return strings.TrimSuffix(ownerDest, filepath.Ext(ownerDest)) + filepath.Ext(sidecarName)
+}
+
+// sidecarsByOwner gets the sidecars of each file, keyed by the file's source path
+func sidecarsByOwner(groups map[string]*fileGroup) map[string][]string {
+	sidecars := make(map[string][]string)
+	for _, group := range groups {
+		for _, s := range group.sidecars {
+			sidecars[s.owner] = append(sidecars[s.owner], s.path)
+		}
+	}
+	return sidecars
+}
+
+func toReportGroup(group *fileGroup, files map[string]image_manager.ImageData, destinationPath string) report.Group {
+	destinations := make(map[string]string)
+	for _, f := range files {
+		destinations[f.GetFilePath()] = destinationPath + "/" + f.DestPath
+	}
+
+	parentDest := destinations[group.parent]
+	g := report.Group{
+		Type:   groupTypeRelated,
+		Parent: report.File{Role: roleRaw, Source: group.parent, Destination: parentDest},
+	}
+	if !image_manager.IsRawType(filepath.Ext(group.parent)) {
+		g.Parent.Role = ""
+	}
+	for _, pair := range group.pairs {
+		g.Members = append(g.Members, report.File{Role: rolePair, Source: pair, Destination: destinations[pair]})
+	}
+	for _, sidecar := range group.sidecars {
+		g.Members = append(g.Members, report.File{Role: roleSidecar, Source: sidecar.path,
+			Destination: sidecarDestPath(sidecar.path, sidecar.owner, destinations[sidecar.owner])})
+	}
+	for _, edit := range group.edits {
+		g.Members = append(g.Members, report.File{Role: roleEdit, Source: edit, Destination: destinations[edit]})
+	}
+	return g
+}
+
+// stemKey is the folder and lower case name up to the first dot, so "IMG_1234.CR3.dop" and
+// "IMG_1234.JPG" in the same folder have the same key
+func stemKey(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	if i := strings.Index(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return filepath.Join(filepath.Dir(path), name)
+}
+
+// rawGroupOfEdit finds the raw whose stem the key starts with, followed by a separator such as "-" or "_"
+func rawGroupOfEdit(key string, groups map[string]*fileGroup) (*fileGroup, bool) {
+	folderLen := len(filepath.Dir(key)) + 1
+	for i := len(key) - 1; i > folderLen; i-- {
+		r := rune(key[i])
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			continue
+		}
+		group, ok := groups[key[:i]]
+		if ok && image_manager.IsRawType(filepath.Ext(group.parent)) {
+			return group, true
+		}
+	}
+	return nil, false
+}
@@ -1,51 +1,200 @@
 package sorting
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
 	"go.uber.org/zap"
 
 	"github.com/photos-sorter/file_manager"
 	"github.com/photos-sorter/image_manager"
+	"github.com/photos-sorter/pkg/clock"
 	"github.com/photos-sorter/pkg/config"
+	"github.com/photos-sorter/pkg/event"
+	"github.com/photos-sorter/pkg/genutils"
+	"github.com/photos-sorter/pkg/metadata"
+	"github.com/photos-sorter/pkg/progress"
+	"github.com/photos-sorter/pkg/report"
 )
 
-func SortImages(logger *zap.Logger, cfg config.Config, moveFile func(*zap.Logger, string, string) error) error {
-	imageFiles, err := file_manager.GetFilesAllDepths(
-		logger, cfg.SourcePath, image_manager.GetImageTypes(), true, image_manager.GetPhoto)
+func SortImages(ctx context.Context, logger *zap.Logger, cfg config.Config,
+	moveFile func(*zap.Logger, string, string) error,
+) error {
+	extractor := newMetadataExtractor(logger, cfg)
+	defer extractor.Close()
+	runReport := report.New()
+
+	file_manager.Progress.SetStage(progress.StageFinding)
+	imageFiles, related, err := findImageFiles(ctx, logger, cfg, extractor, runReport)
 	if err != nil {
-		return fmt.Errorf("failed to get image files from all depths: %w", err)
+		return fmt.Errorf("failed to get image files: %w", err)
 	}
+	for path, i := range imageFiles {
+		i = image_manager.CorrectTimestamp(logger, i, cfg.ClockOffsets)
+		i = image_manager.AddPlace(logger, i, cfg.Geocoder)
+		imageFiles[path] = image_manager.AddSite(logger, i, cfg.Sites)
+	}
+	imageFiles = filterByMetadata(logger, cfg.Filter, imageFiles,
+		image_manager.GetTimestamp, image_manager.ImageData.GetCameraModel, runReport)
 
 	logger.Info("Got image files", zap.Int("count", len(imageFiles)))
+	logger.Info("Got sidecar files", zap.Int("count", len(related.sidecars)))
+
+	livePhotos := findLivePhotoClips(ctx, logger, cfg, extractor, imageFiles, related.clips)
 
-	// sorting into folder structure of "<type>/<year>/<month>/<day>/<file>"
-	// where type is either raw, edited or other,
+	logger.Info("Got live photo videos", zap.Int("count", len(livePhotos)))
+
+	timestampWriter, err := newTimestampWriter(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create timestamp writer: %w", err)
+	}
+	if timestampWriter != nil {
+		defer timestampWriter.Close()
+	}
+
+	// sorting into the folder structure from the image path templates, by default
+	// "<type>/<year>/<month>/<day>/<file>" where type is either raw, edited or other,
 	// other will be of format "<other>/<year>/<file>"
-	usingImageFilesWithPath(logger, cfg, imageFiles, moveFile)
-	return nil
+	sortErr := usingImageFilesWithPath(ctx, logger, cfg, imageFiles, related.sidecars, livePhotos, moveFile,
+		timestampWriter, runReport)
+
+	// the report is still written when interrupted, so it shows what was moved
+	reportPath, err := runReport.Write(cfg.DestinationPath)
+	if err != nil {
+		return errors.Join(sortErr, fmt.Errorf("failed to write report: %w", err))
+	}
+	logger.Info("Wrote report",
+		zap.String("path", reportPath),
+		zap.Int("filtered", len(runReport.Filtered)),
+		zap.Int("errors", len(runReport.Errors)))
+	return sortErr
+}
+
+// relatedPaths being the sidecars and live photo clips found while walking for images, which are looked up by
+// the images they belong to once every image has been read
+type relatedPaths struct {
+	sidecars []string
+	clips    []string
 }
 
-func usingImageFilesWithPath(logger *zap.Logger, cfg config.Config,
+// findImageFiles walks the source path once, reading the images' metadata in batches as they are found and
+// collecting the paths of the sidecars and live photo clips. Images are filtered by their size too, the others
+// only by their path.
+func findImageFiles(ctx context.Context, logger *zap.Logger, cfg config.Config, extractor *metadata.Registry,
+	runReport *report.Report,
+) (map[string]image_manager.ImageData, relatedPaths, error) {
+	skipImage := skipFiltered(logger, cfg.Filter, cfg.SourcePath, runReport, true)
+	skipRelated := skipFiltered(logger, cfg.Filter, cfg.SourcePath, nil, false)
+	isRelated := func(name string) (bool, bool) {
+		ext := metadata.Ext(name)
+		return genutils.InArray(image_manager.GetSidecarTypes(), ext), genutils.InArray(livePhotoClipTypes, ext)
+	}
+	skip := func(path string, e os.DirEntry) bool {
+		if isSidecar, isClip := isRelated(e.Name()); !e.IsDir() && (isSidecar || isClip) {
+			return skipRelated(path, e)
+		}
+		return skipImage(path, e)
+	}
+
+	var related relatedPaths
+	batch := newMetadataBatch(ctx, logger, cfg, extractor, runReport, image_manager.PhotoFromMetadata)
+	fileTypes := append(append(append([]string{}, image_manager.GetImageTypes()...),
+		image_manager.GetSidecarTypes()...), livePhotoClipTypes...)
+	for path, err := range findFiles(logger, cfg, fileTypes, skip) {
+		if err != nil {
+			return nil, related, err
+		}
+		switch isSidecar, isClip := isRelated(path); {
+		case isSidecar:
+			related.sidecars = append(related.sidecars, path)
+		case isClip:
+			related.clips = append(related.clips, path)
+		default:
+			if err := batch.add(path); err != nil {
+				return nil, related, err
+			}
+		}
+	}
+	imageFiles, err := batch.done()
+	return imageFiles, related, err
+}
+
+func usingImageFilesWithPath(ctx context.Context, logger *zap.Logger, cfg config.Config,
 	imageFiles map[string]image_manager.ImageData,
+	sidecars []string,
+	livePhotos map[string]string,
 	moveFile func(*zap.Logger, string, string) error,
-) {
+	timestampWriter *clock.MetadataWriter,
+	runReport *report.Report,
+) error {
 	logger.Info("Sorting files using source paths", zap.String("destinationPath", cfg.DestinationPath))
 	err := file_manager.CreateFolderIfNotExists(logger, cfg.DestinationPath)
 	if err != nil {
-		logger.Fatal("failed to create destination path",
-			zap.String("destinationPath", cfg.DestinationPath),
-			zap.Error(err))
+		return fmt.Errorf("failed to create destination path: %w", err)
+	}
+
+	file_manager.Progress.SetStage(progress.StageGrouping)
+	imageFiles, err = findEvents(logger, cfg.Events, cfg.DestinationPath, imageFiles,
+		func(path string, i image_manager.ImageData) event.Item {
+			location, ok := i.GetLocation()
+			return eventItem(path, image_manager.GetTimestamp(i), location, ok)
+		}, image_manager.WithEvent)
+	if err != nil {
+		return fmt.Errorf("failed to find events: %w", err)
 	}
 
+	imageFiles, hashes := hashFiles(logger, cfg.ImageNameTemplate(), imageFiles,
+		image_manager.ImageData.GetFilePath, runReport)
 	filesWithPath := file_manager.AddFolderPathToFile(
 		logger,
 		imageFiles,
-		addingFolderToImagePath,
+		addingFolderToImagePath(cfg.ImageRules(), cfg.ImagePathTemplates(), cfg.ImageNameTemplate(),
+			sequenceNumbers(imageFiles, image_manager.ImageData.GetFilePath, image_manager.GetTimestamp), hashes),
 	)
 
-	file_manager.FilesToMoveCount = len(filesWithPath)
+	// raw+jpeg pairs are kept in the raw's folder and sidecars follow the file they belong to,
+	// so bursts and brackets are grouped into their subfolders before the pairs are moved
+	groups := groupRelatedFiles(logger, filesWithPath, sidecars)
+	filesWithPath, sequences := groupSequences(logger, cfg.Sequences, cfg.DestinationPath, filesWithPath, groups)
+	filesWithPath = keepPairsTogether(filesWithPath, groups)
+	filesWithPath, duplicates, err := findDuplicates(ctx, logger, cfg.Duplicates, cfg.MetadataWorkers,
+		cfg.DestinationPath, filesWithPath, groups, sequences)
+	if err != nil {
+		return err
+	}
+	filesWithPath, err = scoreQuality(ctx, logger, cfg.Quality, cfg.MetadataWorkers, cfg.DestinationPath,
+		filesWithPath, groups, duplicates, runReport)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		runReport.AddGroup(toReportGroup(group, filesWithPath, cfg.DestinationPath))
+	}
+	for _, g := range append(sequences, duplicates...) {
+		runReport.AddGroup(g)
+	}
+	logger.Info("Grouped related files",
+		zap.Int("groups", len(groups)),
+		zap.Int("sequences", len(sequences)),
+		zap.Int("duplicates", len(duplicates)))
+
+	sidecarsOf := sidecarsByOwner(groups)
+	total := len(filesWithPath) + len(livePhotos)
+	for _, fileSidecars := range sidecarsOf {
+		total += len(fileSidecars)
+	}
+	// sidecarDests being the sidecars' destinations in this run, so two sidecars given the same one are
+	// reported rather than the second being taken as already sorted
+	sidecarDests := make(map[string]string)
+	file_manager.Progress.SetTotal(total)
+	file_manager.Progress.SetStage(progress.StageSorting)
 	for _, file := range filesWithPath {
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped sorting images: %w", ctx.Err())
+		}
 		logger.Debug("copying/moving file",
 			zap.String("destination", cfg.DestinationPath+"/"+file.DestPath),
 			zap.String("file", file.GetFileName()),
@@ -53,20 +202,75 @@ func usingImageFilesWithPath(logger *zap.Logger, cfg config.Config,
 
 		err := file_manager.CreatePathFoldersIfDoesntExists(logger, cfg.DestinationPath, file.DestPath)
 		if err != nil {
-			logger.Fatal("failed to create folder in destination path",
-				zap.String("folderName", file.GetFilePath()),
+			logger.Error("failed to create folder in destination path",
+				zap.String("folderName", file.DestPath),
 				zap.Error(err))
+			runReport.AddError(file.GetFilePath(), report.StageMove, err)
+			continue
 		}
 
+		// motion photos are found by their source name, which the destination may not keep
+		motionVideo, isMotionPhoto := findMotionPhoto(logger, file)
+
 		err = moveFile(
 			logger,
 			file.GetFilePath(),
 			cfg.DestinationPath+"/"+file.DestPath)
 		if err != nil {
-			logger.Fatal("failed to copy and rename file",
+			logger.Error("failed to copy and rename file",
 				zap.String("destination", cfg.DestinationPath+"/"+file.DestPath),
 				zap.String("file", file.GetFileName()),
 				zap.Error(err))
+			runReport.AddError(file.GetFilePath(), report.StageMove, err)
+			continue
+		}
+
+		if timestampWriter != nil && file.IsTimeCorrected() {
+			writeCorrectedTimestamp(logger, timestampWriter,
+				cfg.DestinationPath+"/"+file.DestPath, image_manager.GetTimestamp(file))
+		}
+
+		if fileSidecars, ok := sidecarsOf[file.GetFilePath()]; ok {
+			moveSidecars(logger, cfg, fileSidecars, file, sidecarDests, moveFile, runReport)
+		}
+
+		if clip, ok := livePhotos[file.GetFilePath()]; ok {
+			moveLivePhotoClip(logger, cfg.DestinationPath, clip, file, moveFile, runReport)
+		}
+		if isMotionPhoto {
+			handleMotionPhoto(logger, cfg.DestinationPath, cfg.ExtractMotionPhotoVideo, file, motionVideo, runReport)
+		}
+	}
+	writeSequenceSummaries(logger, sequences, runReport)
+	return nil
+}
+
+func moveSidecars(logger *zap.Logger, cfg config.Config, sidecars []string, owner image_manager.ImageData,
+	sidecarDests map[string]string, moveFile func(*zap.Logger, string, string) error, runReport *report.Report,
+) {
+	for _, sidecar := range sidecars {
+		dest := cfg.DestinationPath + "/" + sidecarDestPath(sidecar, owner.GetFilePath(), owner.DestPath)
+		logger.Debug("copying/moving sidecar",
+			zap.String("destination", dest),
+			zap.String("sidecar", sidecar),
+			zap.String("file", owner.GetFilePath()))
+
+		if other, ok := sidecarDests[strings.ToLower(dest)]; ok {
+			err := fmt.Errorf("%w: %s is also the destination of %s", file_manager.ErrDestinationTaken, dest, other)
+			logger.Error("failed to copy and rename sidecar", zap.String("sidecar", sidecar), zap.Error(err))
+			file_manager.Progress.CopyFailed()
+			runReport.AddError(sidecar, report.StageMove, err)
+			continue
+		}
+		sidecarDests[strings.ToLower(dest)] = sidecar
+
+		err := moveFile(logger, sidecar, dest)
+		if err != nil {
+			logger.Error("failed to copy and rename sidecar",
+				zap.String("destination", dest),
+				zap.String("sidecar", sidecar),
+				zap.Error(err))
+			runReport.AddError(sidecar, report.StageMove, err)
 		}
 	}
 }
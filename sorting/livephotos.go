@@ -0,0 +1,265 @@
+package sorting
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/photos-sorter/image_manager"
+	"github.com/photos-sorter/pkg/config"
+	"github.com/photos-sorter/pkg/genutils"
+	"github.com/photos-sorter/pkg/metadata"
+	"github.com/photos-sorter/pkg/report"
+	"github.com/photos-sorter/video_manager"
+)
+
+const (
+	groupTypeLivePhoto   = "live photo"
+	groupTypeMotionPhoto = "motion photo"
+
+	roleStill = "still"
+	roleVideo = "video"
+
+	// livePhotoMaxTimeDifference being how far apart a still and its video can be taken
+	livePhotoMaxTimeDifference = 3 * time.Second
+)
+
+// livePhotoClipTypes being the video types apple saves the clip of a live photo as
+var livePhotoClipTypes = []string{"mov"}
+
+// findLivePhotoClips matches apple live photo videos to their stills by name, confirming with the
+// content identifier when exiftool is available or the capture time, keyed by the still's source path
+func findLivePhotoClips(ctx context.Context, logger *zap.Logger, cfg config.Config, extractor *metadata.Registry,
+	files map[string]image_manager.ImageData, clips []string,
+) map[string]string {
+	stills := make(map[string]image_manager.ImageData)
+	for _, f := range files {
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(f.GetFileName()), "."))
+		if genutils.InArray(image_manager.GetLivePhotoStillTypes(), ext) {
+			stills[stemKey(f.GetFilePath())] = f
+		}
+	}
+
+	var candidates, candidateStills []string
+	for _, clip := range clips {
+		if still, ok := stills[stemKey(clip)]; ok {
+			candidates = append(candidates, clip)
+			candidateStills = append(candidateStills, still.GetFilePath())
+		}
+	}
+	if len(candidates) == 0 {
+		return map[string]string{}
+	}
+
+	clipResults := extractor.ExtractAll(ctx, logger, candidates, cfg.MetadataWorkers)
+
+	// the still's content identifier is in apple's maker notes, which only exiftool reads
+	stillResults := make([]metadata.Result, len(candidateStills))
+	if exiftool, ok := extractor.Get(metadata.ExtractorExiftool); ok {
+		if batch, ok := exiftool.(metadata.BatchExtractor); ok {
+			stillResults = batch.ExtractBatch(logger, candidateStills)
+		}
+	}
+
+	livePhotos := make(map[string]string)
+	for i, clip := range candidates {
+		if !isSameLivePhoto(logger, clipResults[i], stillResults[i], stills[stemKey(clip)]) {
+			continue
+		}
+		livePhotos[candidateStills[i]] = clip
+	}
+	return livePhotos
+}
+
+func isSameLivePhoto(logger *zap.Logger, clipResult, stillResult metadata.Result, still image_manager.ImageData) bool {
+	clip := clipResult.Path
+	if clipResult.Err != nil {
+		logger.Warn("failed to get live photo video data, matching by name only",
+			zap.String("clip", clip),
+			zap.Error(clipResult.Err))
+		return true
+	}
+	v := video_manager.VideoFromMetadata(clip, clipResult.Record)
+
+	if stillResult.Err != nil {
+		logger.Warn("failed to get live photo still content identifier",
+			zap.String("still", still.GetFilePath()),
+			zap.Error(stillResult.Err))
+	}
+	stillIdentifier := stillResult.Record.ContentIdentifier
+
+	if v.GetContentIdentifier() != "" && stillIdentifier != "" {
+		if v.GetContentIdentifier() != stillIdentifier {
+			logger.Debug("video has the same name as a still but a different content identifier",
+				zap.String("clip", clip),
+				zap.String("still", still.GetFilePath()))
+			return false
+		}
+		return true
+	}
+
+	clipTime, stillTime := video_manager.GetTimestamp(v), image_manager.GetTimestamp(still)
+	if clipTime.IsZero() || stillTime.IsZero() {
+		return true
+	}
+	difference := clipTime.Sub(stillTime)
+	if difference < -livePhotoMaxTimeDifference || difference > livePhotoMaxTimeDifference {
+		logger.Debug("video has the same name as a still but a different capture time",
+			zap.String("clip", clip),
+			zap.String("still", still.GetFilePath()),
+			zap.Duration("difference", difference))
+		return false
+	}
+	return true
+}
+
+// companionDestPath names a live photo or motion photo video after its still's destination
+func companionDestPath(stillDest, ext string) string {
+	return strings.TrimSuffix(stillDest, filepath.Ext(stillDest)) + ext
+}
+
+func moveLivePhotoClip(logger *zap.Logger, destinationPath, clip string, still image_manager.ImageData,
+	moveFile func(*zap.Logger, string, string) error, runReport *report.Report,
+) {
+	dest := destinationPath + "/" + companionDestPath(still.DestPath, filepath.Ext(clip))
+	logger.Debug("copying/moving live photo video",
+		zap.String("destination", dest),
+		zap.String("clip", clip),
+		zap.String("still", still.GetFilePath()))
+
+	err := moveFile(logger, clip, dest)
+	if err != nil {
+		logger.Error("failed to copy and rename live photo video",
+			zap.String("destination", dest),
+			zap.String("clip", clip),
+			zap.Error(err))
+		runReport.AddError(clip, report.StageMove, err)
+		return
+	}
+
+	runReport.AddGroup(report.Group{
+		Type:    groupTypeLivePhoto,
+		Parent:  report.File{Role: roleStill, Source: still.GetFilePath(), Destination: destinationPath + "/" + still.DestPath},
+		Members: []report.File{{Role: roleVideo, Source: clip, Destination: dest}},
+	})
+}
+
+// findMotionPhoto checks whether the still is a google motion photo before it is copied or moved
+func findMotionPhoto(logger *zap.Logger, still image_manager.ImageData) (image_manager.MotionPhotoVideo, bool) {
+	video, ok, err := image_manager.FindMotionPhotoVideo(still.GetFilePath())
+	if err != nil {
+		logger.Error("failed to check for motion photo",
+			zap.String("file", still.GetFilePath()),
+			zap.Error(err))
+		return image_manager.MotionPhotoVideo{}, false
+	}
+	return video, ok
+}
+
+// handleMotionPhoto records a google motion photo and optionally extracts its embedded video, reading the
+// still at its destination as it has already been copied or moved there
+func handleMotionPhoto(logger *zap.Logger, destinationPath string, extractVideo bool,
+	still image_manager.ImageData, video image_manager.MotionPhotoVideo, runReport *report.Report,
+) {
+	stillDest := destinationPath + "/" + still.DestPath
+	group := report.Group{
+		Type:   groupTypeMotionPhoto,
+		Parent: report.File{Role: roleStill, Source: still.GetFilePath(), Destination: stillDest},
+	}
+	if extractVideo {
+		dest := destinationPath + "/" + companionDestPath(still.DestPath, ".mp4")
+		err := image_manager.ExtractMotionPhotoVideo(stillDest, video, dest)
+		switch {
+		case errors.Is(err, image_manager.ErrVideoExists):
+			logger.Info("skipped extracting motion photo video, it already exists",
+				zap.String("file", still.GetFilePath()),
+				zap.String("destination", dest))
+			group.Summary = "video skipped, " + dest + " already exists"
+		case err != nil:
+			logger.Error("failed to extract motion photo video",
+				zap.String("file", still.GetFilePath()),
+				zap.String("destination", dest),
+				zap.Error(err))
+			runReport.AddError(still.GetFilePath(), report.StageMove, err)
+		default:
+			logger.Debug("extracted motion photo video",
+				zap.String("file", still.GetFilePath()),
+				zap.String("destination", dest))
+			group.Members = append(group.Members, report.File{Role: roleVideo, Source: still.GetFilePath(), Destination: dest})
+		}
+	}
+	runReport.AddGroup(group)
+}
+
+// withoutLivePhotoClips drops the videos that are the clip of a live photo, these are sorted with their still.
+// The stills are read and filtered as the image sort does, and each clip confirmed in the same way, so only the
+// clips the image sort moves are dropped
+func withoutLivePhotoClips(ctx context.Context, logger *zap.Logger, cfg config.Config, extractor *metadata.Registry,
+	videoFiles map[string]video_manager.VideoData,
+) (map[string]video_manager.VideoData, error) {
+	var clips []string
+	clipStems := make(map[string]bool)
+	for _, v := range videoFiles {
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(v.GetFileName()), "."))
+		if genutils.InArray(livePhotoClipTypes, ext) {
+			clips = append(clips, v.GetFilePath())
+			clipStems[stemKey(v.GetFilePath())] = true
+		}
+	}
+	if len(clips) == 0 {
+		return videoFiles, nil
+	}
+
+	var stillPaths []string
+	for path, err := range findFiles(logger, cfg, image_manager.GetLivePhotoStillTypes(),
+		skipFiltered(logger, cfg.Filter, cfg.SourcePath, nil, true)) {
+		if err != nil {
+			return nil, err
+		}
+		if clipStems[stemKey(path)] {
+			stillPaths = append(stillPaths, path)
+		}
+	}
+
+	stills := make(map[string]image_manager.ImageData)
+	for _, result := range extractor.ExtractAll(ctx, logger, stillPaths, cfg.MetadataWorkers) {
+		if result.Err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			logger.Debug("failed to get live photo still data, its video is sorted on its own",
+				zap.String("still", result.Path),
+				zap.Error(result.Err))
+			continue
+		}
+		still := image_manager.CorrectTimestamp(logger,
+			image_manager.PhotoFromMetadata(result.Path, result.Record), cfg.ClockOffsets)
+		if reason, filtered := cfg.Filter.CheckMetadata(image_manager.GetTimestamp(still), still.GetCameraModel()); filtered {
+			logger.Debug("live photo still is filtered out, its video is sorted on its own",
+				zap.String("still", result.Path),
+				zap.String("reason", reason))
+			continue
+		}
+		stills[result.Path] = still
+	}
+
+	livePhotoClips := make(map[string]bool)
+	for _, clip := range findLivePhotoClips(ctx, logger, cfg, extractor, stills, clips) {
+		livePhotoClips[clip] = true
+	}
+
+	videos := make(map[string]video_manager.VideoData)
+	for name, v := range videoFiles {
+		if livePhotoClips[v.GetFilePath()] {
+			logger.Debug("skipping live photo video, it is sorted with its still",
+				zap.String("file", v.GetFilePath()))
+			continue
+		}
+		videos[name] = v
+	}
+	return videos, nil
+}
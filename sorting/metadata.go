@@ -0,0 +1,135 @@
+package sorting
+
+import (
+	"context"
+	"iter"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/photos-sorter/file_manager"
+	"github.com/photos-sorter/image_manager"
+	"github.com/photos-sorter/pkg/config"
+	"github.com/photos-sorter/pkg/metadata"
+	"github.com/photos-sorter/pkg/report"
+	"github.com/photos-sorter/video_manager"
+)
+
+// newMetadataExtractor sets up the metadata backends, imagemeta and the native quicktime parser are always
+// available and exiftool is the fallback when it is on the path, the config can pick the backends per file type.
+// When sites are found by camera serial, files without one go on to the next backend for it.
+func newMetadataExtractor(logger *zap.Logger, cfg config.Config) *metadata.Registry {
+	extractors := []metadata.Extractor{image_manager.ImagemetaExtractor{}, video_manager.QuicktimeExtractor{}}
+
+	exiftoolExtractor, err := metadata.NewExiftoolExtractor(cfg.ExiftoolProcesses)
+	if err != nil {
+		logger.Warn("exiftool not available, only images and mp4, mov and 3gp videos can be read",
+			zap.Error(err))
+	} else {
+		extractors = append(extractors, exiftoolExtractor)
+	}
+	registry := metadata.NewRegistry(cfg.MetadataExtractors, extractors...)
+	if cfg.Sites.UsesCameraSerials() {
+		registry.ReadCameraSerials()
+	}
+	return registry
+}
+
+// metadataBatchSize being how many files have their metadata read at once, so reading starts as soon as the
+// first files are found rather than after the whole source path has been walked
+const metadataBatchSize = 500
+
+// findFiles streams the paths of the files of the given types under the source path that aren't skipped
+func findFiles(logger *zap.Logger, cfg config.Config, fileTypes []string, skip func(string, os.DirEntry) bool,
+) iter.Seq2[string, error] {
+	return file_manager.WalkFiles(logger, cfg.SourcePath, fileTypes, true, cfg.Walk, skip)
+}
+
+// extractFiles reads the metadata of the files in batches as they are found, keyed by path. Files that can't
+// be read are logged, added to the report and left out
+func extractFiles[T any](ctx context.Context, logger *zap.Logger, cfg config.Config, extractor *metadata.Registry,
+	paths iter.Seq2[string, error], runReport *report.Report, fromMetadata func(string, metadata.Record) T,
+) (map[string]T, error) {
+	batch := newMetadataBatch(ctx, logger, cfg, extractor, runReport, fromMetadata)
+	for path, err := range paths {
+		if err != nil {
+			return nil, err
+		}
+		if err := batch.add(path); err != nil {
+			return nil, err
+		}
+	}
+	return batch.done()
+}
+
+// metadataBatch reads the metadata of the files added to it a batch at a time. Only what fromMetadata builds
+// from each record is kept, but that is kept for every file until all of them have been read, as pairs, events,
+// sequences and duplicates are found across all of them before any file is copied or moved
+type metadataBatch[T any] struct {
+	ctx          context.Context
+	logger       *zap.Logger
+	workers      int
+	extractor    *metadata.Registry
+	runReport    *report.Report
+	fromMetadata func(string, metadata.Record) T
+
+	paths []string
+	files map[string]T
+}
+
+func newMetadataBatch[T any](ctx context.Context, logger *zap.Logger, cfg config.Config, extractor *metadata.Registry,
+	runReport *report.Report, fromMetadata func(string, metadata.Record) T,
+) *metadataBatch[T] {
+	return &metadataBatch[T]{
+		ctx:          ctx,
+		logger:       logger,
+		workers:      cfg.MetadataWorkers,
+		extractor:    extractor,
+		runReport:    runReport,
+		fromMetadata: fromMetadata,
+		paths:        make([]string, 0, metadataBatchSize),
+		files:        make(map[string]T),
+	}
+}
+
+// add queues the file, reading the queued files' metadata once there is a full batch
+func (b *metadataBatch[T]) add(path string) error {
+	file_manager.Progress.Discovered()
+	b.paths = append(b.paths, path)
+	if len(b.paths) < metadataBatchSize {
+		return nil
+	}
+	if err := b.extract(); err != nil {
+		return err
+	}
+	b.logger.Debug("read metadata of files found so far", zap.Int("count", len(b.files)))
+	return nil
+}
+
+// done reads the files left in the last batch, returning every file read
+func (b *metadataBatch[T]) done() (map[string]T, error) {
+	if err := b.extract(); err != nil {
+		return nil, err
+	}
+	return b.files, nil
+}
+
+func (b *metadataBatch[T]) extract() error {
+	for _, result := range b.extractor.ExtractAll(b.ctx, b.logger, b.paths, b.workers) {
+		if result.Err != nil {
+			if b.ctx.Err() != nil {
+				return b.ctx.Err()
+			}
+			b.logger.Error("failed to get file data",
+				zap.String("file", result.Path),
+				zap.Error(result.Err))
+			b.runReport.AddError(result.Path, report.StageMetadata, result.Err)
+			file_manager.Progress.Failed()
+			continue
+		}
+		b.files[result.Path] = b.fromMetadata(result.Path, result.Record)
+		file_manager.Progress.Extracted()
+	}
+	b.paths = b.paths[:0]
+	return nil
+}
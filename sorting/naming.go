@@ -0,0 +1,91 @@
+package sorting
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/photos-sorter/file_manager"
+	"github.com/photos-sorter/pkg/pathtemplate"
+	"github.com/photos-sorter/pkg/report"
+)
+
+// sequenceNumbers numbers the files by when they were taken, starting again from 1 for each day,
+// keyed by the file's source path
+func sequenceNumbers[T any](files map[string]T, getPath func(T) string, getTimestamp func(T) time.Time) map[string]int {
+	ordered := make([]T, 0, len(files))
+	for _, f := range files {
+		ordered = append(ordered, f)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		ti, tj := getTimestamp(ordered[i]), getTimestamp(ordered[j])
+		if ti.Equal(tj) {
+			return getPath(ordered[i]) < getPath(ordered[j])
+		}
+		return ti.Before(tj)
+	})
+
+	seqNumbers := make(map[string]int, len(ordered))
+	var day string
+	var seq int
+	for _, f := range ordered {
+		fileDay := getTimestamp(f).Format(time.DateOnly)
+		if fileDay != day {
+			day = fileDay
+			seq = 0
+		}
+		seq++
+		seqNumbers[getPath(f)] = seq
+	}
+	return seqNumbers
+}
+
+// hashFiles hashes the files when the name template uses {hash}, keyed by the file's source path. Files that
+// can't be hashed are reported and left out, rather than named with an empty hash another file could share
+func hashFiles[T any](logger *zap.Logger, nameTemplate pathtemplate.Template, files map[string]T,
+	getPath func(T) string, runReport *report.Report,
+) (map[string]T, map[string]string) {
+	hashes := make(map[string]string)
+	if !nameTemplate.UsesToken(pathtemplate.TokenHash) {
+		return files, hashes
+	}
+	for name, f := range files {
+		hash, err := fileHash(nameTemplate, getPath(f))
+		if err != nil {
+			logger.Error("failed to hash file for renaming, leaving it in place",
+				zap.String("file", getPath(f)),
+				zap.Error(err))
+			runReport.AddError(getPath(f), report.StageMove, err)
+			file_manager.Progress.Failed()
+			delete(files, name)
+			continue
+		}
+		hashes[getPath(f)] = hash
+	}
+	return files, hashes
+}
+
+// fileHash hashes the file when the name template uses {hash}, otherwise it is empty
+func fileHash(nameTemplate pathtemplate.Template, path string) (string, error) {
+	if !nameTemplate.UsesToken(pathtemplate.TokenHash) {
+		return "", nil
+	}
+	hash, err := file_manager.ShortHash(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash file for renaming: %w", err)
+	}
+	return hash, nil
+}
+
+// renameFile sets the new file name on the values from the name template, with the file's sequence number
+// and hash
+func renameFile(nameTemplate pathtemplate.Template, seqNumbers map[string]int, hashes map[string]string,
+	path string, values pathtemplate.Values,
+) pathtemplate.Values {
+	values.Seq = seqNumbers[path]
+	values.Hash = hashes[path]
+	values.FileName = nameTemplate.Execute(values)
+	return values
+}
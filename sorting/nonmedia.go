@@ -0,0 +1,134 @@
+package sorting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/photos-sorter/file_manager"
+	"github.com/photos-sorter/image_manager"
+	"github.com/photos-sorter/pkg/config"
+	"github.com/photos-sorter/pkg/progress"
+	"github.com/photos-sorter/pkg/report"
+	"github.com/photos-sorter/video_manager"
+)
+
+const (
+	nonMediaFolder = "non-media"
+	noExtension    = "no-extension"
+)
+
+// osJunkFiles being the files operating systems leave in folders, which are never worth sorting,
+// "._*" being the apple double files macs write on drives that don't support their metadata
+var osJunkFiles = []string{".DS_Store", "Thumbs.db", "desktop.ini", "._*"}
+
+// SortNonMedia sorts every file that isn't an image, sidecar or video, such as documents and takeout json,
+// into "non-media/<extension>/" keeping the folders they were in under the source path
+func SortNonMedia(ctx context.Context, logger *zap.Logger, cfg config.Config,
+	moveFile func(*zap.Logger, string, string) error,
+) error {
+	runReport := report.New()
+
+	mediaTypes := append(append(image_manager.GetImageTypes(), image_manager.GetSidecarTypes()...),
+		video_manager.GetVideoTypes()...)
+	skip := skipFiltered(logger, cfg.Filter, cfg.SourcePath, runReport, true)
+	// files are moved while the source path is still being walked, so a destination inside it is left out
+	destinationPath := filepath.Clean(cfg.DestinationPath)
+	files := file_manager.WalkFiles(logger, cfg.SourcePath, mediaTypes, false, cfg.Walk,
+		func(path string, e os.DirEntry) bool {
+			if e.IsDir() {
+				return path == destinationPath || skip(path, e)
+			}
+			return isOSJunk(e.Name()) || skip(path, e)
+		})
+
+	sortErr := usingNonMediaFilesWithPath(ctx, logger, cfg, files, moveFile, runReport)
+
+	reportPath, err := runReport.Write(cfg.DestinationPath)
+	if err != nil {
+		return errors.Join(sortErr, fmt.Errorf("failed to write report: %w", err))
+	}
+	logger.Info("Wrote report",
+		zap.String("path", reportPath),
+		zap.Int("filtered", len(runReport.Filtered)),
+		zap.Int("errors", len(runReport.Errors)))
+	return sortErr
+}
+
+// usingNonMediaFilesWithPath moves each file as it is found, as non media files don't need to be looked at
+// together the way images do
+func usingNonMediaFilesWithPath(ctx context.Context, logger *zap.Logger, cfg config.Config,
+	files iter.Seq2[string, error],
+	moveFile func(*zap.Logger, string, string) error,
+	runReport *report.Report,
+) error {
+	err := file_manager.CreateFolderIfNotExists(logger, cfg.DestinationPath)
+	if err != nil {
+		return fmt.Errorf("failed to create destination path: %w", err)
+	}
+
+	// the total isn't known until the walk is done, so only the counts are shown
+	file_manager.Progress.SetStage(progress.StageSorting)
+	var count int
+	for path, err := range files {
+		if err != nil {
+			return fmt.Errorf("failed to get non media files: %w", err)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped sorting non media files: %w", ctx.Err())
+		}
+		count++
+		file_manager.Progress.Discovered()
+
+		destPath := nonMediaDestPath(cfg.SourcePath, path)
+		err := file_manager.CreatePathFoldersIfDoesntExists(logger, cfg.DestinationPath, destPath)
+		if err != nil {
+			logger.Error("failed to create folder in destination path",
+				zap.String("folderName", destPath),
+				zap.Error(err))
+			runReport.AddError(path, report.StageMove, err)
+			continue
+		}
+
+		err = moveFile(logger, path, cfg.DestinationPath+"/"+destPath)
+		if err != nil {
+			logger.Error("failed to copy and rename file",
+				zap.String("destination", cfg.DestinationPath+"/"+destPath),
+				zap.String("file", path),
+				zap.Error(err))
+			runReport.AddError(path, report.StageMove, err)
+		}
+	}
+
+	logger.Info("Sorted non media files", zap.Int("count", count))
+	return nil
+}
+
+// nonMediaDestPath is "non-media/<extension>/<path under the source path>", as files such as takeout's
+// "metadata.json" have the same name in every folder
+func nonMediaDestPath(sourcePath, path string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if ext == "" {
+		ext = noExtension
+	}
+	relPath, err := filepath.Rel(sourcePath, path)
+	if err != nil {
+		relPath = filepath.Base(path)
+	}
+	return filepath.ToSlash(filepath.Join(nonMediaFolder, ext, relPath))
+}
+
+func isOSJunk(name string) bool {
+	for _, junk := range osJunkFiles {
+		if ok, _ := filepath.Match(junk, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package sorting
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"github.com/photos-sorter/image_manager"
+	"github.com/photos-sorter/pkg/quality"
+	"github.com/photos-sorter/pkg/report"
+)
+
+const rejectsFolder = "rejects"
+
+// scoreQuality scores how sharp and well exposed each image is, listing the rejects in the report and, when the
+// options say to, sorting them into the rejects folder. Pairs are rejected along with their raw, and
+// duplicates are left out as they have already been set aside.
+func scoreQuality(ctx context.Context, logger *zap.Logger, opts quality.Options, workers int,
+	destinationPath string, files map[string]image_manager.ImageData, groups map[string]*fileGroup,
+	duplicates []report.Group, runReport *report.Report,
+) (map[string]image_manager.ImageData, error) {
+	if !opts.Enabled() {
+		return files, nil
+	}
+
+	skip := make(map[string]bool)
+	for _, group := range groups {
+		for _, pair := range group.pairs {
+			skip[pair] = true
+		}
+	}
+	for _, g := range duplicates {
+		for _, m := range g.Members {
+			skip[m.Source] = true
+		}
+	}
+
+	var paths []string
+	for path := range files {
+		if !skip[path] {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	scores := make([]*quality.Scores, len(paths))
+	err := inParallel(ctx, workers, len(paths), func(i int) {
+		s, err := image_manager.GetQualityScores(files[paths[i]])
+		if err != nil {
+			logger.Debug("failed to score image, not checking its quality",
+				zap.String("file", paths[i]),
+				zap.Error(err))
+			return
+		}
+		scores[i] = &s
+	})
+	if err != nil {
+		return nil, fmt.Errorf("stopped scoring images: %w", err)
+	}
+
+	var rejects int
+	for i, path := range paths {
+		if scores[i] == nil {
+			continue
+		}
+		f := image_manager.WithQuality(files[path], *scores[i])
+		reason, rejected := opts.Reject(*scores[i])
+		if rejected {
+			rejects++
+			if opts.MoveRejects {
+				f.DestPath = filepath.Join(rejectsFolder, f.DestPath)
+				if group, ok := groups[path]; ok {
+					for _, pair := range group.pairs {
+						if p, ok := files[pair]; ok {
+							p.DestPath = filepath.Join(rejectsFolder, p.DestPath)
+							files[pair] = p
+						}
+					}
+				}
+			}
+			runReport.AddReject(report.Reject{
+				Source:      path,
+				Destination: destinationPath + "/" + f.DestPath,
+				Reason:      reason,
+				Sharpness:   scores[i].Sharpness,
+				Shadows:     scores[i].Shadows,
+				Highlights:  scores[i].Highlights,
+			})
+			logger.Debug("rejected image",
+				zap.String("file", path),
+				zap.String("reason", reason),
+				zap.Stringer("scores", scores[i]))
+		}
+		files[path] = f
+	}
+	logger.Info("Scored image quality", zap.Int("scored", len(paths)), zap.Int("rejects", rejects))
+	return files, nil
+}
@@ -0,0 +1,107 @@
+package sorting
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/photos-sorter/image_manager"
+	"github.com/photos-sorter/pkg/report"
+	"github.com/photos-sorter/pkg/sequence"
+)
+
+const (
+	roleShot = "shot"
+
+	// sequenceSummaryFile being written into each burst and bracket subfolder, saying what the sequence is
+	sequenceSummaryFile = "sequence.txt"
+)
+
+// groupSequences moves each burst and bracket into its own subfolder of where it would be sorted, named
+// after its first shot such as "burst_134432_IMG_1234", pairs are left out as they follow their raw.
+// The subfolder gets a summary file once the files are sorted, see writeSequenceSummaries
+func groupSequences(logger *zap.Logger, opts sequence.Options, destinationPath string,
+	files map[string]image_manager.ImageData, groups map[string]*fileGroup,
+) (map[string]image_manager.ImageData, []report.Group) {
+	if !opts.Enabled() {
+		return files, nil
+	}
+
+	pairs := make(map[string]bool)
+	for _, group := range groups {
+		for _, pair := range group.pairs {
+			pairs[pair] = true
+		}
+	}
+
+	// shots from the same camera sorted into the same folder
+	shots := make(map[string][]sequence.Shot)
+	for name, f := range files {
+		if f.GetCameraModel() == "" || pairs[f.GetFilePath()] {
+			continue
+		}
+		key := f.GetCameraMake() + "|" + f.GetCameraModel() + "|" + filepath.Dir(f.DestPath)
+		shots[key] = append(shots[key], sequence.Shot{
+			ID:           name,
+			Time:         image_manager.GetTimestamp(f),
+			ExposureBias: f.GetExposureBias(),
+			AutoBracket:  f.IsAutoBracket(),
+		})
+	}
+
+	var reportGroups []report.Group
+	for _, cameraShots := range shots {
+		for _, s := range sequence.Find(cameraShots, opts) {
+			first := files[s.Shots[0].ID]
+			firstName := filepath.Base(first.DestPath)
+			folder := filepath.Join(filepath.Dir(first.DestPath),
+				s.Type+"_"+strings.TrimSuffix(firstName, filepath.Ext(firstName)))
+
+			g := report.Group{Type: s.Type, Summary: s.Summary()}
+			for i, shot := range s.Shots {
+				f := files[shot.ID]
+				f.DestPath = filepath.Join(folder, filepath.Base(f.DestPath))
+				files[shot.ID] = f
+
+				member := report.File{Role: roleShot, Source: f.GetFilePath(), Destination: destinationPath + "/" + f.DestPath}
+				if i == 0 {
+					g.Parent = member
+				} else {
+					g.Members = append(g.Members, member)
+				}
+			}
+			logger.Debug("found sequence",
+				zap.String("type", s.Type),
+				zap.String("summary", g.Summary),
+				zap.String("folder", folder))
+			reportGroups = append(reportGroups, g)
+		}
+	}
+	return files, reportGroups
+}
+
+// writeSequenceSummaries writes the type and summary of each burst and bracket into its subfolder, followed by
+// its shots, once the files have been sorted. Sequences whose shots all went elsewhere have no folder to write to
+func writeSequenceSummaries(logger *zap.Logger, sequences []report.Group, runReport *report.Report) {
+	for _, g := range sequences {
+		folder := filepath.Dir(g.Parent.Destination)
+		if _, err := os.Stat(folder); err != nil {
+			continue
+		}
+
+		lines := []string{g.Type + ": " + g.Summary}
+		for _, f := range append([]report.File{g.Parent}, g.Members...) {
+			lines = append(lines, filepath.Base(f.Destination))
+		}
+		path := filepath.Join(folder, sequenceSummaryFile)
+		err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0640)
+		if err != nil {
+			logger.Error("failed to write sequence summary",
+				zap.String("file", path),
+				zap.Error(err))
+			runReport.AddError(path, report.StageMove, err)
+		}
+	}
+}
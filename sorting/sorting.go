@@ -1,171 +1,180 @@
 package sorting
 
 import (
-	"fmt"
-	"strconv"
+	"context"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/photos-sorter/image_manager"
-	"github.com/photos-sorter/pkg/genutils"
+	"github.com/photos-sorter/pkg/clock"
+	"github.com/photos-sorter/pkg/config"
+	"github.com/photos-sorter/pkg/pathtemplate"
+	"github.com/photos-sorter/pkg/rules"
 	"github.com/photos-sorter/video_manager"
 )
 
-var (
-	rawImageTypes    = []string{"raw", "cr3", "cr2"}
-	editedImageTypes = []string{"jpg", "jpeg"}
-
-	editedImageContainText       = []string{"dxo", "enhanced", "cr3"}
-	editedImageSuffixes          = []string{"e", "tz", "ps", "nr"}
-	editedDuplicateImageSuffixes = []string{
-		"_0%d", "_%d",
-		"-0%d", "-%d",
-		"(0%d)", "(%d)",
-		"0%d", "%d",
-		"~0%d", "~%d"}
-
-	videoCameraModelKeywords = []string{"canon", "dc-fz82", "panasonic", "gardepro"}
-
-	acceptedCameraModels = []string{"canon", "dc-fz82"}
-
-	// fullPathFormat being: top folder / date sub folders / filename
-	// the date sub folders are in the format: year / month / day /
-	fullPathFormat = "%s/%s%s"
-)
-
-func addingFolderToImagePath(logger *zap.Logger, file image_manager.ImageData) image_manager.ImageData {
-	editOrRawFile := isImageEditedOrRaw(logger, file)
-	timestamp := image_manager.GetTimestamp(file)
-	year := strconv.Itoa(timestamp.Year())
-	if editOrRawFile == "other" {
-		file.DestPath = createNewFullPath(editOrRawFile, createDateSubfolders(year), file.GetFileName())
-	} else {
-		month := strconv.Itoa(int(timestamp.Month()))
-		if len(month) == 1 {
-			month = "0" + month
-		}
-		day := strconv.Itoa(timestamp.Day())
-		if len(day) == 1 {
-			day = "0" + day
-		}
-		file.DestPath = createNewFullPath(editOrRawFile, createDateSubfolders(year, month, day), file.GetFileName())
+func addingFolderToImagePath(ruleSet rules.RuleSet, templates pathtemplate.Set,
+	nameTemplate pathtemplate.Template, seqNumbers map[string]int, hashes map[string]string,
+) func(*zap.Logger, image_manager.ImageData) image_manager.ImageData {
+	return func(logger *zap.Logger, file image_manager.ImageData) image_manager.ImageData {
+		category := classifyImage(logger, ruleSet, file)
+		values := renameFile(nameTemplate, seqNumbers, hashes, file.GetFilePath(),
+			imagePathValues(category, file))
+		file.DestPath = templates.For(category).Execute(values)
+		return file
 	}
-
-	return file
 }
 
-func addingFolderToVideoPath(logger *zap.Logger, file video_manager.VideoData) video_manager.VideoData {
-	timestamp := video_manager.GetTimestamp(file)
-	year := strconv.Itoa(timestamp.Year())
-
-	rootFolder := isVideoWildlifeOrNot(logger, file)
-
-	file.DestPath = createNewFullPath(rootFolder, createDateSubfolders(year), file.GetFileName())
-	return file
+func addingFolderToVideoPath(ruleSet rules.RuleSet, templates pathtemplate.Set,
+	nameTemplate pathtemplate.Template, seqNumbers map[string]int, hashes map[string]string,
+) func(*zap.Logger, video_manager.VideoData) video_manager.VideoData {
+	return func(logger *zap.Logger, file video_manager.VideoData) video_manager.VideoData {
+		category := classifyVideo(logger, ruleSet, file)
+		values := renameFile(nameTemplate, seqNumbers, hashes, file.GetFilePath(),
+			videoPathValues(category, file))
+		file.DestPath = templates.For(category).Execute(values)
+		return file
+	}
 }
 
-func isImageEditedOrRaw(logger *zap.Logger, i image_manager.ImageData) string {
-	name := i.GetFileName()
-
-	splitName := strings.Split(name, ".")
-	if len(splitName) < 2 {
-		return ""
+func imagePathValues(class string, file image_manager.ImageData) pathtemplate.Values {
+	name := file.GetFileName()
+	ext := filepath.Ext(name)
+	return pathtemplate.Values{
+		Class:  class,
+		Camera: file.GetCameraModel(),
+		Name:   strings.TrimSuffix(name, ext),
+		Ext:    ext,
+		Time:   image_manager.GetTimestamp(file),
+
+		Country: file.GetPlace().Country,
+		Region:  file.GetPlace().Region,
+		Place:   file.GetPlace().Name,
+		Site:    file.GetSite(),
+		Event:   file.GetEvent(),
 	}
+}
 
-	fileName := strings.ToLower(splitName[0])
-	fileType := strings.ToLower(splitName[1])
-	logger = logger.With(
-		zap.String("fileName", fileName),
-		zap.String("fileType", fileType),
-		zap.String("fullFileName", name))
-
-	// if the file is in the rawFileTypes it will only be a raw file
-	if genutils.InArray(rawImageTypes, fileType) {
-		logger.Debug("file is a raw file")
-		return "raw"
+func videoPathValues(class string, file video_manager.VideoData) pathtemplate.Values {
+	name := file.GetFileName()
+	ext := filepath.Ext(name)
+	return pathtemplate.Values{
+		Class:  class,
+		Camera: file.GetCameraModel(),
+		Name:   strings.TrimSuffix(name, ext),
+		Ext:    ext,
+		Time:   video_manager.GetTimestamp(file),
+
+		Country: file.GetPlace().Country,
+		Region:  file.GetPlace().Region,
+		Place:   file.GetPlace().Name,
+		Site:    file.GetSite(),
+		Event:   file.GetEvent(),
 	}
+}
 
-	switch {
-	case !genutils.InArray(editedImageTypes, fileType):
-		logger.Debug("file is not an edited file type")
-		return "other"
-	case isAcceptedCameraModel(i):
-		logger.Debug("file has an accepted camera model",
-			zap.String("cameraModel", i.GetCameraModel()))
-		return "edited"
-	case genutils.ContainsFromArray(editedImageContainText, fileName):
-		logger.Debug("file contains edited file text")
-		return "edited"
-	case hasEditSuffix(name):
-		logger.Debug("file has an edit suffix")
-		return "edited"
-	default:
-		logger.Debug("file is not a raw or edited file")
-		return "other"
-	}
+func classifyImage(logger *zap.Logger, ruleSet rules.RuleSet, i image_manager.ImageData) string {
+	category, ruleName := ruleSet.Classify(imageRulesSubject(i))
+	logger.Debug("classified image",
+		zap.String("fullFileName", i.GetFileName()),
+		zap.String("cameraModel", i.GetCameraModel()),
+		zap.String("rule", ruleName),
+		zap.String("category", category))
+	return category
 }
 
-func isVideoWildlifeOrNot(logger *zap.Logger, v video_manager.VideoData) string {
-	name := v.GetFileName()
-	camera := v.GetCameraModel()
+func classifyVideo(logger *zap.Logger, ruleSet rules.RuleSet, v video_manager.VideoData) string {
+	category, ruleName := ruleSet.Classify(videoRulesSubject(v))
+	logger.Debug("classified video",
+		zap.String("fullFileName", v.GetFileName()),
+		zap.String("cameraModel", v.GetCameraModel()),
+		zap.String("rule", ruleName),
+		zap.String("category", category))
+	return category
+}
 
-	splitName := strings.Split(name, ".")
-	if len(splitName) < 2 {
-		logger.Error("video name does not have a file type",
-			zap.String("fullFileName", name))
-		return "" //todo here is an issue
-	}
+func imageRulesSubject(i image_manager.ImageData) rules.Subject {
+	width, height := i.GetDimensions()
+	return toRulesSubject(i.GetFileName(), i.GetFilePath(), rules.Subject{
+		IsRaw:       image_manager.IsRawType(filepath.Ext(i.GetFileName())),
+		CameraMake:  i.GetCameraMake(),
+		CameraModel: i.GetCameraModel(),
+		Lens:        i.GetLens(),
+		Software:    i.GetSoftware(),
+		Width:       width,
+		Height:      height,
+		Site:        i.GetSite(),
+	})
+}
 
-	fileName := strings.ToLower(splitName[0])
-	logger = logger.With(
-		zap.String("fileName", fileName),
-		zap.String("fullFileName", name))
-
-	//todo: add a check if the name has something useful in it?
-	switch {
-	case genutils.StringsContainInArray(videoCameraModelKeywords, strings.ToLower(camera)):
-		logger.Debug("video has a wildlife camera model",
-			zap.String("cameraModel", camera))
-		return "wildlife"
-	default:
-		logger.Debug("video does not have a wildlife camera model")
-		return "other"
-	}
+func videoRulesSubject(v video_manager.VideoData) rules.Subject {
+	width, height := v.GetDimensions()
+	return toRulesSubject(v.GetFileName(), v.GetFilePath(), rules.Subject{
+		CameraMake:  v.GetCameraMake(),
+		CameraModel: v.GetCameraModel(),
+		Software:    v.GetSoftware(),
+		Width:       width,
+		Height:      height,
+		Site:        v.GetSite(),
+	})
 }
 
-func createDateSubfolders(subFolders ...string) string {
-	var dateSubfolders string
-	for _, subFolder := range subFolders {
-		dateSubfolders += subFolder + "/"
-	}
-	return dateSubfolders
+// toRulesSubject adds the file name, extension and source folder to the subject's metadata
+func toRulesSubject(name, path string, subject rules.Subject) rules.Subject {
+	ext := filepath.Ext(name)
+	subject.FileName = strings.TrimSuffix(name, ext)
+	subject.Extension = strings.TrimPrefix(ext, ".")
+	subject.SourceFolder = filepath.Dir(path)
+	return subject
 }
 
-func createNewFullPath(topFolder, dateSubfolders, fileName string) string {
-	return fmt.Sprintf(fullPathFormat, topFolder, dateSubfolders, fileName)
+// newTimestampWriter returns nil when corrected timestamps are not being written back
+func newTimestampWriter(cfg config.Config) (*clock.MetadataWriter, error) {
+	if !cfg.WriteCorrectedTime || len(cfg.ClockOffsets) == 0 {
+		return nil, nil
+	}
+	return clock.NewMetadataWriter()
 }
 
-func isAcceptedCameraModel(image image_manager.ImageData) bool {
-	if genutils.StringsContainInArray(acceptedCameraModels, image.GetCameraModel()) {
-		return true
+func writeCorrectedTimestamp(logger *zap.Logger, writer *clock.MetadataWriter, path string, timestamp time.Time) {
+	err := writer.WriteTimestamp(path, timestamp)
+	if err != nil {
+		logger.Error("failed to write corrected timestamp",
+			zap.String("file", path),
+			zap.Time("timestamp", timestamp),
+			zap.Error(err))
+		return
 	}
-	return false
+	logger.Debug("wrote corrected timestamp",
+		zap.String("file", path),
+		zap.Time("timestamp", timestamp))
 }
 
-func hasEditSuffix(name string) bool {
-	for i := 0; i < 10; i++ {
-		for _, dupeSuffixFormat := range editedDuplicateImageSuffixes {
-			dupeSuffix := fmt.Sprintf(dupeSuffixFormat, i)
-			if strings.HasSuffix(name, dupeSuffix) {
-				for _, suffix := range editedImageSuffixes {
-					fullSuffix := dupeSuffix + suffix
-					if strings.HasSuffix(name, fullSuffix) {
-						return true
-					}
-				}
+// inParallel calls do for each index from 0 to n with a number of workers, such as to decode images,
+// stopping early when the context is done
+func inParallel(ctx context.Context, workers, n int, do func(int)) error {
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				do(i)
 			}
+		}()
+	}
+	for i := range n {
+		if ctx.Err() != nil {
+			break
 		}
+		next <- i
 	}
-	return false
+	close(next)
+	wg.Wait()
+	return ctx.Err()
 }
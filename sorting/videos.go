@@ -1,51 +1,107 @@
 package sorting
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"go.uber.org/zap"
 
 	"github.com/photos-sorter/file_manager"
+	"github.com/photos-sorter/pkg/clock"
 	"github.com/photos-sorter/pkg/config"
+	"github.com/photos-sorter/pkg/event"
+	"github.com/photos-sorter/pkg/progress"
+	"github.com/photos-sorter/pkg/report"
 	"github.com/photos-sorter/video_manager"
 )
 
-func SortVideos(logger *zap.Logger, cfg config.Config) error {
-	err := video_manager.InitExifTool()
+func SortVideos(ctx context.Context, logger *zap.Logger, cfg config.Config) error {
+	extractor := newMetadataExtractor(logger, cfg)
+	defer extractor.Close()
+	runReport := report.New()
+
+	file_manager.Progress.SetStage(progress.StageFinding)
+	videoPaths := findFiles(logger, cfg, video_manager.GetVideoTypes(),
+		skipFiltered(logger, cfg.Filter, cfg.SourcePath, runReport, true))
+	videoFiles, err := extractFiles(ctx, logger, cfg, extractor, videoPaths, runReport, video_manager.VideoFromMetadata)
 	if err != nil {
-		return fmt.Errorf("failed to init exiftool: %w", err)
+		return fmt.Errorf("failed to get video files: %w", err)
+	}
+	for path, v := range videoFiles {
+		v = video_manager.CorrectTimestamp(logger, v, cfg.ClockOffsets)
+		v = video_manager.AddPlace(logger, v, cfg.Geocoder)
+		videoFiles[path] = video_manager.AddSite(logger, v, cfg.Sites)
 	}
+	videoFiles = filterByMetadata(logger, cfg.Filter, videoFiles,
+		video_manager.GetTimestamp, video_manager.VideoData.GetCameraModel, runReport)
 
-	videoFiles, err := file_manager.GetFilesAllDepths(
-		logger, cfg.SourcePath, video_manager.GetVideoTypes(), true, video_manager.GetVideo)
+	logger.Info("Got video files", zap.Int("count", len(videoFiles)))
+
+	videoFiles, err = withoutLivePhotoClips(ctx, logger, cfg, extractor, videoFiles)
 	if err != nil {
-		return fmt.Errorf("failed to get video files from all depths: %w", err)
+		return fmt.Errorf("failed to get live photo stills from all depths: %w", err)
 	}
 
-	logger.Info("Got video files", zap.Int("count", len(videoFiles)))
+	timestampWriter, err := newTimestampWriter(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create timestamp writer: %w", err)
+	}
+	if timestampWriter != nil {
+		defer timestampWriter.Close()
+	}
 
-	// sorting into folder structure of "<type>/<year>/<file>"
-	// where type is either wildlife or other
-	usingVideoFilesWithPath(logger, cfg, videoFiles)
-	return nil
+	// sorting into the folder structure from the video path templates, by default
+	// "<type>/<year>/<file>" where type is either wildlife or other
+	sortErr := usingVideoFilesWithPath(ctx, logger, cfg, videoFiles, timestampWriter, runReport)
+
+	reportPath, err := runReport.Write(cfg.DestinationPath)
+	if err != nil {
+		return errors.Join(sortErr, fmt.Errorf("failed to write report: %w", err))
+	}
+	logger.Info("Wrote report",
+		zap.String("path", reportPath),
+		zap.Int("filtered", len(runReport.Filtered)),
+		zap.Int("errors", len(runReport.Errors)))
+	return sortErr
 }
 
-func usingVideoFilesWithPath(logger *zap.Logger, cfg config.Config, videoFiles map[string]video_manager.VideoData) {
+func usingVideoFilesWithPath(ctx context.Context, logger *zap.Logger, cfg config.Config,
+	videoFiles map[string]video_manager.VideoData,
+	timestampWriter *clock.MetadataWriter,
+	runReport *report.Report,
+) error {
 	logger.Info("Sorting files using source paths", zap.String("destinationPath", cfg.DestinationPath))
 	err := file_manager.CreateFolderIfNotExists(logger, cfg.DestinationPath)
 	if err != nil {
-		logger.Fatal("failed to create destination path",
-			zap.String("destinationPath", cfg.DestinationPath),
-			zap.Error(err))
+		return fmt.Errorf("failed to create destination path: %w", err)
+	}
+
+	file_manager.Progress.SetStage(progress.StageGrouping)
+	videoFiles, err = findEvents(logger, cfg.Events, cfg.DestinationPath, videoFiles,
+		func(path string, v video_manager.VideoData) event.Item {
+			location, ok := v.GetLocation()
+			return eventItem(path, video_manager.GetTimestamp(v), location, ok)
+		}, video_manager.WithEvent)
+	if err != nil {
+		return fmt.Errorf("failed to find events: %w", err)
 	}
 
+	videoFiles, hashes := hashFiles(logger, cfg.VideoNameTemplate(), videoFiles,
+		video_manager.VideoData.GetFilePath, runReport)
 	filesWithPath := file_manager.AddFolderPathToFile(
 		logger,
 		videoFiles,
-		addingFolderToVideoPath,
+		addingFolderToVideoPath(cfg.VideoRules(), cfg.VideoPathTemplates(), cfg.VideoNameTemplate(),
+			sequenceNumbers(videoFiles, video_manager.VideoData.GetFilePath, video_manager.GetTimestamp), hashes),
 	)
 
+	file_manager.Progress.SetTotal(len(filesWithPath))
+	file_manager.Progress.SetStage(progress.StageSorting)
 	for _, file := range filesWithPath {
+		if ctx.Err() != nil {
+			return fmt.Errorf("stopped sorting videos: %w", ctx.Err())
+		}
 		logger.Debug("copying file",
 			zap.String("destination", cfg.DestinationPath+"/"+file.DestPath),
 			zap.String("file", file.GetFileName()),
@@ -53,9 +109,11 @@ func usingVideoFilesWithPath(logger *zap.Logger, cfg config.Config, videoFiles m
 
 		err := file_manager.CreatePathFoldersIfDoesntExists(logger, cfg.DestinationPath, file.DestPath)
 		if err != nil {
-			logger.Fatal("failed to create folder in destination path",
-				zap.String("folderName", file.GetFilePath()),
+			logger.Error("failed to create folder in destination path",
+				zap.String("folderName", file.DestPath),
 				zap.Error(err))
+			runReport.AddError(file.GetFilePath(), report.StageMove, err)
+			continue
 		}
 
 		err = file_manager.MoveAndRenameFile(
@@ -67,6 +125,14 @@ func usingVideoFilesWithPath(logger *zap.Logger, cfg config.Config, videoFiles m
 				zap.String("destination", cfg.DestinationPath+"/"+file.DestPath),
 				zap.String("file", file.GetFileName()),
 				zap.Error(err))
+			runReport.AddError(file.GetFilePath(), report.StageMove, err)
+			continue
+		}
+
+		if timestampWriter != nil && file.IsTimeCorrected() {
+			writeCorrectedTimestamp(logger, timestampWriter,
+				cfg.DestinationPath+"/"+file.DestPath, video_manager.GetTimestamp(file))
 		}
 	}
+	return nil
 }
@@ -0,0 +1,482 @@
+package video_manager
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/evanoberholster/imagemeta"
+	"go.uber.org/zap"
+
+	"github.com/photos-sorter/pkg/metadata"
+)
+
+const (
+	// maxMoovSize being the largest movie box read into memory, it only holds the metadata and sample tables
+	maxMoovSize = 64 << 20
+)
+
+var (
+	ErrNoMovieBox = errors.New("no moov box")
+
+	// quicktimeEpoch being the time mvhd, tkhd and mdhd dates count seconds from
+	quicktimeEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// quicktimeFileTypes being the iso base media and quicktime containers the native parser reads
+	quicktimeFileTypes = []string{"mp4", "mov", "m4v", "3gp", "3g2"}
+
+	// appleCreationDateLayouts being how com.apple.quicktime.creationdate is written
+	appleCreationDateLayouts = []string{"2006-01-02T15:04:05-0700", time.RFC3339}
+)
+
+// QuicktimeExtractor reads mp4 and quicktime metadata from the movie box without exiftool
+type QuicktimeExtractor struct{}
+
+// quicktimeData being what is read from the movie box, before the capture date is picked
+type quicktimeData struct {
+	make              string
+	model             string
+	serial            string
+	software          string
+	encoder           string
+	comment           string
+	width             int
+	height            int
+	rotation          int
+	duration          time.Duration
+	createDate        time.Time
+	trackCreateDate   time.Time
+	mediaCreateDate   time.Time
+	creationDate      time.Time
+	dateTimeOriginal  time.Time
+	contentIdentifier string
+	location          string
+}
+
+// box being a box's type and its contents without the header, types such as "©mak" start with 0xa9
+type box struct {
+	boxType string
+	data    []byte
+}
+
+func (QuicktimeExtractor) Name() string {
+	return metadata.ExtractorQuicktime
+}
+
+func (QuicktimeExtractor) Supports(ext string) bool {
+	for _, t := range quicktimeFileTypes {
+		if t == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func (QuicktimeExtractor) Close() {}
+
+func (QuicktimeExtractor) Extract(logger *zap.Logger, path string) (metadata.Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return metadata.Record{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	moov, err := readMovieBox(f)
+	if err != nil {
+		return metadata.Record{}, err
+	}
+
+	var data quicktimeData
+	for _, b := range childBoxes(moov) {
+		switch b.boxType {
+		case "mvhd":
+			created, _, duration, ok := parseMediaHeader(b.data)
+			if ok {
+				data.createDate = created
+				data.duration = duration
+			}
+		case "trak":
+			parseTrack(b.data, &data)
+		case "udta":
+			parseUserData(logger, b.data, &data)
+		case "meta":
+			parseMetadata(b.data, &data)
+		}
+	}
+	logger.Debug("read quicktime metadata", zap.String("path", path), zap.Any("data", fmt.Sprintf("%+v", data)))
+	return data.toRecord(), nil
+}
+
+// toRecord picks the capture date, apple's creation date and the exif in canon's thumbnail are the
+// local time the video was taken, which matches the photos from the same camera, rather than the utc CreateDate
+func (d quicktimeData) toRecord() metadata.Record {
+	r := metadata.Record{
+		Make:              d.make,
+		Model:             d.model,
+		CameraSerial:      d.serial,
+		Software:          d.software,
+		Width:             d.width,
+		Height:            d.height,
+		Orientation:       metadata.RotationOrientation(d.rotation),
+		Duration:          d.duration,
+		ContentIdentifier: d.contentIdentifier,
+		Location:          metadata.ParseISO6709(d.location),
+	}
+	// some cameras, such as trail cameras, only write their model in the comment
+	if r.Model == "" {
+		r.Model = d.comment
+	}
+	if r.Software == "" {
+		r.Software = d.encoder
+	}
+
+	dates := []struct {
+		name string
+		t    time.Time
+	}{
+		{"CreationDate", d.creationDate},
+		{"DateTimeOriginal", d.dateTimeOriginal},
+		{"CreateDate", d.createDate},
+		{"TrackCreateDate", d.trackCreateDate},
+		{"MediaCreateDate", d.mediaCreateDate},
+	}
+	for _, date := range dates {
+		if !date.t.IsZero() {
+			r.Timestamp = date.t
+			r.TimestampSource = metadata.ExtractorQuicktime + " " + date.name
+			break
+		}
+	}
+	return r
+}
+
+// readMovieBox reads the moov box, skipping over the media data which may come before it
+func readMovieBox(r io.ReadSeeker) ([]byte, error) {
+	header := make([]byte, 16)
+	for {
+		_, err := io.ReadFull(r, header[:8])
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrNoMovieBox
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read box header: %w", err)
+		}
+
+		size := uint64(binary.BigEndian.Uint32(header))
+		boxType := string(header[4:8])
+		headerSize := uint64(8)
+		if size == 1 {
+			_, err = io.ReadFull(r, header[8:16])
+			if err != nil {
+				return nil, fmt.Errorf("failed to read box size: %w", err)
+			}
+			size = binary.BigEndian.Uint64(header[8:16])
+			headerSize = 16
+		}
+
+		switch {
+		case size == 0 && boxType == "moov":
+			// the last box runs to the end of the file
+			moov, err := io.ReadAll(io.LimitReader(r, maxMoovSize))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read moov box: %w", err)
+			}
+			return moov, nil
+		case size == 0:
+			return nil, ErrNoMovieBox
+		case size < headerSize:
+			return nil, fmt.Errorf("invalid %q box size %d", boxType, size)
+		case boxType == "moov":
+			if size-headerSize > maxMoovSize {
+				return nil, fmt.Errorf("moov box too large: %d", size)
+			}
+			moov := make([]byte, size-headerSize)
+			_, err = io.ReadFull(r, moov)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read moov box: %w", err)
+			}
+			return moov, nil
+		default:
+			_, err = r.Seek(int64(size-headerSize), io.SeekCurrent)
+			if err != nil {
+				return nil, fmt.Errorf("failed to skip %q box: %w", boxType, err)
+			}
+		}
+	}
+}
+
+func childBoxes(data []byte) []box {
+	var boxes []box
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data))
+		headerSize := uint64(8)
+		if size == 1 {
+			if len(data) < 16 {
+				break
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			headerSize = 16
+		} else if size == 0 {
+			size = uint64(len(data))
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			break
+		}
+		boxes = append(boxes, box{boxType: string(data[4:8]), data: data[headerSize:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+func findBox(boxes []box, boxType string) (box, bool) {
+	for _, b := range boxes {
+		if b.boxType == boxType {
+			return b, true
+		}
+	}
+	return box{}, false
+}
+
+// parseMediaHeader reads the dates and duration of a mvhd or mdhd box, which share their layout
+func parseMediaHeader(data []byte) (time.Time, time.Time, time.Duration, bool) {
+	var created, modified, duration uint64
+	var timescale uint32
+	switch {
+	case len(data) >= 32 && data[0] == 1:
+		created = binary.BigEndian.Uint64(data[4:12])
+		modified = binary.BigEndian.Uint64(data[12:20])
+		timescale = binary.BigEndian.Uint32(data[20:24])
+		duration = binary.BigEndian.Uint64(data[24:32])
+	case len(data) >= 20 && data[0] == 0:
+		created = uint64(binary.BigEndian.Uint32(data[4:8]))
+		modified = uint64(binary.BigEndian.Uint32(data[8:12]))
+		timescale = binary.BigEndian.Uint32(data[12:16])
+		duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+	default:
+		return time.Time{}, time.Time{}, 0, false
+	}
+
+	var d time.Duration
+	if timescale != 0 {
+		d = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+	}
+	return quicktimeTime(created), quicktimeTime(modified), d, true
+}
+
+// parseTrack reads the video track's header and media header, other tracks are skipped
+func parseTrack(data []byte, v *quicktimeData) {
+	boxes := childBoxes(data)
+	mdia, ok := findBox(boxes, "mdia")
+	if !ok {
+		return
+	}
+	mdiaBoxes := childBoxes(mdia.data)
+	hdlr, ok := findBox(mdiaBoxes, "hdlr")
+	if !ok || len(hdlr.data) < 12 || string(hdlr.data[8:12]) != "vide" {
+		return
+	}
+
+	if tkhd, ok := findBox(boxes, "tkhd"); ok {
+		created, width, height, rotation, ok := parseTrackHeader(tkhd.data)
+		if ok {
+			v.trackCreateDate = created
+			v.width = width
+			v.height = height
+			v.rotation = rotation
+		}
+	}
+	if mdhd, ok := findBox(mdiaBoxes, "mdhd"); ok {
+		created, _, _, ok := parseMediaHeader(mdhd.data)
+		if ok {
+			v.mediaCreateDate = created
+		}
+	}
+}
+
+// parseTrackHeader reads the creation date, the 16.16 fixed point display size and the rotation
+// from the display matrix of a tkhd box
+func parseTrackHeader(data []byte) (time.Time, int, int, int, bool) {
+	var created uint64
+	var matrixOffset int
+	switch {
+	case len(data) >= 96 && data[0] == 1:
+		created = binary.BigEndian.Uint64(data[4:12])
+		matrixOffset = 52
+	case len(data) >= 84 && data[0] == 0:
+		created = uint64(binary.BigEndian.Uint32(data[4:8]))
+		matrixOffset = 40
+	default:
+		return time.Time{}, 0, 0, 0, false
+	}
+
+	const one = 1 << 16
+	a := int32(binary.BigEndian.Uint32(data[matrixOffset:]))
+	b := int32(binary.BigEndian.Uint32(data[matrixOffset+4:]))
+	var rotation int
+	switch {
+	case a == 0 && b == one:
+		rotation = 90
+	case a == -one && b == 0:
+		rotation = 180
+	case a == 0 && b == -one:
+		rotation = 270
+	}
+
+	width := int(binary.BigEndian.Uint32(data[matrixOffset+36:]) >> 16)
+	height := int(binary.BigEndian.Uint32(data[matrixOffset+40:]) >> 16)
+	return quicktimeTime(created), width, height, rotation, true
+}
+
+// parseUserData reads the quicktime "©mak" style text boxes, the itunes style metadata and canon's boxes
+func parseUserData(logger *zap.Logger, data []byte, v *quicktimeData) {
+	for _, b := range childBoxes(data) {
+		switch b.boxType {
+		case "\xa9mak":
+			v.make = userDataText(b.data)
+		case "\xa9mod":
+			v.model = userDataText(b.data)
+		case "\xa9swr":
+			v.software = userDataText(b.data)
+		case "\xa9too", "\xa9enc":
+			v.encoder = userDataText(b.data)
+		case "\xa9cmt":
+			v.comment = userDataText(b.data)
+		case "\xa9xyz":
+			v.location = userDataText(b.data)
+		case "CNMN":
+			// canon's model name
+			v.make = "Canon"
+			v.model = strings.TrimRight(string(b.data), "\x00 ")
+		case "CNTH":
+			parseCanonThumbnail(logger, b.data, v)
+		case "meta":
+			parseMetadata(b.data, v)
+		}
+	}
+}
+
+// userDataText reads a quicktime text box, which is a 16 bit length and language code then the text,
+// or an itunes style box holding a data box
+func userDataText(data []byte) string {
+	if value, ok := itemData(data); ok {
+		return strings.TrimRight(string(value), "\x00")
+	}
+	if len(data) < 4 {
+		return ""
+	}
+	length := int(binary.BigEndian.Uint16(data))
+	if 4+length > len(data) {
+		length = len(data) - 4
+	}
+	return strings.TrimRight(string(data[4:4+length]), "\x00")
+}
+
+// itemData reads the value of a data box, after its 4 byte type and 4 byte locale
+func itemData(data []byte) ([]byte, bool) {
+	d, ok := findBox(childBoxes(data), "data")
+	if !ok || len(d.data) < 8 {
+		return nil, false
+	}
+	return d.data[8:], true
+}
+
+// parseCanonThumbnail reads the exif in the jpeg thumbnail canon cameras store in their movies,
+// which has the make, model, serial number and the local time the video was taken
+func parseCanonThumbnail(logger *zap.Logger, data []byte, v *quicktimeData) {
+	thumbnail, ok := findBox(childBoxes(data), "CNDA")
+	if !ok {
+		return
+	}
+	e, err := imagemeta.Decode(bytes.NewReader(thumbnail.data))
+	if err != nil {
+		logger.Debug("failed to read canon thumbnail exif", zap.Error(err))
+		return
+	}
+	if e.Make != "" {
+		v.make = e.Make
+	}
+	if e.Model != "" {
+		v.model = e.Model
+	}
+	v.serial = e.CameraSerial
+	v.dateTimeOriginal = e.DateTimeOriginal()
+}
+
+// parseMetadata reads a meta box, either quicktime's keys with their values in an ilst box,
+// or itunes style where the ilst holds boxes such as "©too"
+func parseMetadata(data []byte, v *quicktimeData) {
+	// the iso meta box has a version and flags before its children, quicktime's doesn't
+	if len(data) >= 8 && string(data[4:8]) != "hdlr" {
+		data = data[4:]
+	}
+	boxes := childBoxes(data)
+	ilst, ok := findBox(boxes, "ilst")
+	if !ok {
+		return
+	}
+
+	var keys []string
+	if k, ok := findBox(boxes, "keys"); ok && len(k.data) >= 8 {
+		entries := k.data[8:]
+		for len(entries) >= 8 {
+			size := int(binary.BigEndian.Uint32(entries))
+			if size < 8 || size > len(entries) {
+				break
+			}
+			keys = append(keys, string(entries[8:size]))
+			entries = entries[size:]
+		}
+	}
+
+	for _, item := range childBoxes(ilst.data) {
+		value, ok := itemData(item.data)
+		if !ok {
+			continue
+		}
+		key := item.boxType
+		if index := int(binary.BigEndian.Uint32([]byte(item.boxType))); index > 0 && index <= len(keys) {
+			key = keys[index-1]
+		}
+		setMetadataValue(key, strings.TrimRight(string(value), "\x00"), v)
+	}
+}
+
+func setMetadataValue(key, value string, v *quicktimeData) {
+	switch key {
+	case "com.apple.quicktime.make", "com.android.manufacturer":
+		v.make = value
+	case "com.apple.quicktime.model", "com.android.model":
+		v.model = value
+	case "com.apple.quicktime.software", "com.android.version":
+		v.software = value
+	case "com.apple.quicktime.content.identifier":
+		v.contentIdentifier = value
+	case "com.apple.quicktime.location.ISO6709", "\xa9xyz":
+		v.location = value
+	case "com.apple.quicktime.creationdate":
+		for _, layout := range appleCreationDateLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				// keeping the local wall clock time
+				v.creationDate = time.Date(t.Year(), t.Month(), t.Day(),
+					t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+				break
+			}
+		}
+	case "\xa9too", "\xa9enc":
+		v.encoder = value
+	case "\xa9cmt":
+		v.comment = value
+	}
+}
+
+func quicktimeTime(seconds uint64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return quicktimeEpoch.Add(time.Duration(seconds) * time.Second)
+}
@@ -2,42 +2,81 @@ package video_manager
 
 import (
 	"fmt"
+	"path/filepath"
+	"regexp"
 	"time"
 
-	"github.com/barasher/go-exiftool"
 	"go.uber.org/zap"
+
+	"github.com/photos-sorter/pkg/clock"
+	"github.com/photos-sorter/pkg/geocode"
+	"github.com/photos-sorter/pkg/metadata"
 )
 
 var (
-	et              *exiftool.Exiftool
-	NoFileInfoError = fmt.Errorf("no file info")
-	videoFileTypes  = []string{"mp4", "mov", "avi"}
+	videoFileTypes = []string{"mp4", "mov", "avi", "mts", "m2ts", "3gp", "3g2", "mkv", "mpg", "mpeg", "wmv"}
 
 	cameraTypes = []string{"iphone", "pixel", "gardepro", "canon"}
+
+	// avchdStreamRegex matches the clips in an avchd folder structure, such as "PRIVATE/AVCHD/BDMV/STREAM/00000.MTS"
+	avchdStreamRegex = regexp.MustCompile(`(?i)(^|/)BDMV/STREAM/[0-9]+\.m2?ts$`)
 )
 
 type VideoData struct {
-	fileName    string
-	filePath    string
-	cameraModel string
-	timestamp   time.Time
+	fileName     string
+	filePath     string
+	cameraMake   string
+	cameraModel  string
+	cameraSerial string
+	software     string
+	width        int
+	height       int
+	// contentIdentifier links an apple live photo's video to its still
+	contentIdentifier string
+	timestamp         time.Time
+	timestampSource   string
+	timeCorrected     bool
+	orientation       int
+	duration          time.Duration
+	location          *metadata.Location
+	place             geocode.Place
+	site              string
+	event             string
+	// avchdStream being a clip in an avchd folder structure, which are numbered from 00000 on every card
+	avchdStream bool
 	DestPath    string
 }
 
-func InitExifTool() error {
-	var err error
-	et, err = exiftool.NewExiftool()
-	if err != nil {
-		return fmt.Errorf("failed to initialize exiftool: %w", err)
+func toVideoData(r metadata.Record, path string) VideoData {
+	v := VideoData{
+		fileName:          filepath.Base(path),
+		filePath:          path,
+		cameraMake:        r.Make,
+		cameraModel:       r.Model,
+		cameraSerial:      r.CameraSerial,
+		software:          r.Software,
+		width:             r.Width,
+		height:            r.Height,
+		contentIdentifier: r.ContentIdentifier,
+		timestamp:         r.Timestamp,
+		timestampSource:   r.TimestampSource,
+		orientation:       r.Orientation,
+		duration:          r.Duration,
+		location:          r.Location,
+		avchdStream:       avchdStreamRegex.MatchString(filepath.ToSlash(path)),
 	}
-	return nil
-}
-
-func ClearupExifTool() {
-	et.Close()
+	if v.timestamp.IsZero() {
+		v.timestampSource = "none"
+	}
+	return v
 }
 
+// GetFileName is the file's name, avchd clips are named after when they were recorded once any clock
+// offset has been applied, as their numbers repeat on every card
 func (v VideoData) GetFileName() string {
+	if v.avchdStream && !v.timestamp.IsZero() {
+		return v.timestamp.Format("20060102_150405_") + v.fileName
+	}
 	return v.fileName
 }
 
@@ -49,38 +88,139 @@ func (v VideoData) GetCameraModel() string {
 	return v.cameraModel
 }
 
-func GetTimestamp(v VideoData) time.Time {
-	return v.timestamp
+func (v VideoData) GetCameraMake() string {
+	return v.cameraMake
+}
+
+func (v VideoData) GetSoftware() string {
+	return v.software
+}
+
+func (v VideoData) GetDimensions() (int, int) {
+	return v.width, v.height
+}
+
+func (v VideoData) GetContentIdentifier() string {
+	return v.contentIdentifier
+}
+
+// GetOrientation is the exif orientation matching the video's rotation, 1 being upright
+func (v VideoData) GetOrientation() int {
+	return v.orientation
+}
+
+func (v VideoData) GetDuration() time.Duration {
+	return v.duration
+}
+
+// GetLocation is where the video was taken, if it has gps coordinates
+func (v VideoData) GetLocation() (metadata.Location, bool) {
+	if v.location == nil {
+		return metadata.Location{}, false
+	}
+	return *v.location, true
+}
+
+// GetPlace is the nearest known place to where the video was taken, empty without gps coordinates
+func (v VideoData) GetPlace() geocode.Place {
+	return v.place
+}
+
+// AddPlace looks up the nearest known place to the video's gps coordinates
+func AddPlace(logger *zap.Logger, v VideoData, geocoder *geocode.Geocoder) VideoData {
+	location, ok := v.GetLocation()
+	if !ok {
+		return v
+	}
+	place, ok := geocoder.Lookup(location)
+	if !ok {
+		logger.Debug("no known place near video",
+			zap.String("fileName", v.fileName),
+			zap.Float64("latitude", location.Latitude),
+			zap.Float64("longitude", location.Longitude))
+		return v
+	}
+	v.place = place
+	return v
 }
 
-func GetVideo(logger *zap.Logger, path string) (VideoData, error) {
-	var v VideoData
-	fileInfos := et.ExtractMetadata(path)
+func (v VideoData) GetCameraSerial() string {
+	return v.cameraSerial
+}
 
-	if fileInfos == nil {
-		return v, NoFileInfoError
+// GetSite is the named site the video was taken at, if it matched one
+func (v VideoData) GetSite() string {
+	return v.site
+}
+
+// AddSite finds the named site the video was taken at, by its camera's serial number or gps coordinates
+func AddSite(logger *zap.Logger, v VideoData, sites geocode.Sites) VideoData {
+	location, hasLocation := v.GetLocation()
+	site, ok := sites.Find(v.cameraSerial, location, hasLocation)
+	if !ok {
+		return v
 	}
+	logger.Debug("found video site",
+		zap.String("fileName", v.fileName),
+		zap.String("cameraSerial", v.cameraSerial),
+		zap.String("site", site))
+	v.site = site
+	return v
+}
+
+// GetEvent is the name of the event the video was taken at, when events are being found
+func (v VideoData) GetEvent() string {
+	return v.event
+}
+
+func WithEvent(v VideoData, event string) VideoData {
+	v.event = event
+	return v
+}
+
+func (v VideoData) IsTimeCorrected() bool {
+	return v.timeCorrected
+}
 
-	// check this for the cameraTypes to get that
-	// confirm how to get the time data stamp if they are standard or not
-	for _, fileInfo := range fileInfos {
-		if fileInfo.Err != nil {
-			fmt.Printf("Error concerning %v: %v\n", fileInfo.File, fileInfo.Err)
-			continue
-		}
-
-		exifData, err := extractVideoDetails(logger, fileInfo.Fields)
-		if err != nil {
-			logger.Error("failed to extract video details",
-				zap.Error(err),
-				zap.String("file", fileInfo.File),
-				zap.Any("fields", fileInfo.Fields))
-			return v, fmt.Errorf("failed to extract video details: %w", err)
-		}
-		v = exifDataToVideoData(logger, exifData, path)
+// GetTimestampSource describes where the timestamp came from and any correction to it
+func (v VideoData) GetTimestampSource() string {
+	return v.timestampSource
+}
+
+func GetTimestamp(v VideoData) time.Time {
+	return v.timestamp
+}
+
+// CorrectTimestamp applies any matching clock offset to the video's timestamp
+func CorrectTimestamp(logger *zap.Logger, v VideoData, offsets []clock.Offset) VideoData {
+	corrected, ok := clock.Correct(offsets, v.GetCameraModel(), v.timestamp)
+	if !ok {
+		return v
 	}
 
-	return v, nil
+	logger.Debug("corrected video timestamp",
+		zap.String("fileName", v.fileName),
+		zap.String("cameraModel", v.GetCameraModel()),
+		zap.Time("original", v.timestamp),
+		zap.Time("corrected", corrected))
+	v.timestampSource += fmt.Sprintf(" corrected by %s", corrected.Sub(v.timestamp))
+	v.timestamp = corrected
+	v.timeCorrected = true
+	return v
+}
+
+// VideoFromMetadata makes the video data from metadata that has already been extracted, such as in a batch
+func VideoFromMetadata(path string, r metadata.Record) VideoData {
+	return toVideoData(r, path)
+}
+
+// GetVideo reads the video's metadata with the extractor, which picks the backend for the file type
+func GetVideo(logger *zap.Logger, extractor metadata.Extractor, path string) (VideoData, error) {
+	r, err := extractor.Extract(logger, path)
+	if err != nil {
+		return VideoData{}, fmt.Errorf("failed to extract video metadata: %w", err)
+	}
+	return toVideoData(r, path), nil
 }
 
 func GetVideoTypes() []string {
@@ -10,6 +10,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/photos-sorter/file_manager"
+	"github.com/photos-sorter/pkg/walk"
 )
 
 type ZipData struct {
@@ -19,7 +20,7 @@ type ZipData struct {
 }
 
 func GetZipFiles(logger *zap.Logger, path string) (map[string]ZipData, error) {
-	files, err := file_manager.GetFilesAllDepths[ZipData](logger, path, []string{".zip"}, true,
+	files, err := file_manager.GetFilesAllDepths[ZipData](logger, path, []string{".zip"}, true, walk.Options{}, nil,
 		func(logger *zap.Logger, filePath string) (ZipData, error) {
 			return ZipData{
 				Name: filepath.Base(filePath),